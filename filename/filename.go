@@ -0,0 +1,98 @@
+// Package filename reads information from the names of data files: their
+// kind, chain, store and time. Parse reads all of it, and Timestamp reads only
+// the time, also from names that are not of data files.
+//
+// Chains name their files with the local Israel time of publishing, like
+// PriceFull7290027600007-001-202610170300.gz. Times are read in the
+// Asia/Jerusalem time zone, daylight saving time included, so timestamps are
+// real Unix times.
+//
+// Before this package, names were read as UTC, so timestamps in outputs of
+// older versions are 2 or 3 hours late. UseUTC restores the old behavior, for
+// adding to such outputs.
+package filename
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	_ "time/tzdata" // In case the system has no time zone database.
+)
+
+// Israel is the time zone of the times in file names.
+var Israel *time.Location
+
+func init() {
+	var err error
+	Israel, err = time.LoadLocation("Asia/Jerusalem")
+	if err != nil {
+		panic(err)
+	}
+	location = Israel
+}
+
+// Time zone that names are read in.
+var location *time.Location
+
+// UseUTC makes names be read as UTC, like older versions did. Should be
+// called before any name is read.
+func UseUTC() {
+	location = time.UTC
+}
+
+// Location returns the time zone that names are read in, normally Israel.
+func Location() *time.Location {
+	return location
+}
+
+// timestampPattern matches a YYYYMMDDhhmm timestamp in a file name.
+var timestampPattern = regexp.MustCompile("(\\D|^)(20\\d{10})(\\D|$)")
+
+// Timestamp infers the Unix time of a file according to its name, which should
+// be of a data file or have a YYYYMMDDhhmm part. Directories in the path are
+// ignored. Returns -1 if failed.
+func Timestamp(file string) int64 {
+	if info := Parse(file); info != nil {
+		return info.Time
+	}
+	match := timestampPattern.FindStringSubmatch(filepath.Base(file))
+	if match == nil {
+		return -1
+	}
+	t, ok := parseTime(match[2])
+	if !ok {
+		return -1
+	}
+	return t.Unix()
+}
+
+// Returns the time of the given 12 digits. Returns false if they are not a
+// valid time.
+func parseTime(digits string) (time.Time, bool) {
+	year, _ := strconv.Atoi(digits[0:4])
+	month, _ := strconv.Atoi(digits[4:6])
+	day, _ := strconv.Atoi(digits[6:8])
+	hour, _ := strconv.Atoi(digits[8:10])
+	minute, _ := strconv.Atoi(digits[10:12])
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 ||
+		minute > 59 {
+		return time.Time{}, false
+	}
+	return time.Date(year, time.Month(month), day, hour, minute, 0, 0,
+		location), true
+}
+
+// Date returns the YYYY-MM-DD date of the given Unix time, in the time zone of
+// names.
+func Date(ts int64) string {
+	return time.Unix(ts, 0).In(location).Format("2006-01-02")
+}
+
+// Day returns the start of the day of the given time, in the time zone of
+// names.
+func Day(t time.Time) time.Time {
+	t = t.In(location)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)
+}
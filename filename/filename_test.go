@@ -0,0 +1,66 @@
+package filename
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimestamp(t *testing.T) {
+	tests := []struct {
+		name string
+		want time.Time
+	}{
+		// Daylight saving time, UTC+3.
+		{"PriceFull7290027600007-001-202610170300.gz",
+			time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)},
+		// Standard time, UTC+2.
+		{"Price7290027600007-001-202612010030.gz",
+			time.Date(2026, 11, 30, 22, 30, 0, 0, time.UTC)},
+		// Daylight saving time ends on 25/10/2026 at 02:00, back to 01:00.
+		{"Stores7290027600007-202610250030.xml",
+			time.Date(2026, 10, 24, 21, 30, 0, 0, time.UTC)},
+		{"Stores7290027600007-202610250300.xml",
+			time.Date(2026, 10, 25, 1, 0, 0, 0, time.UTC)},
+		{"a/202601010000/Promo7290027600007-001-202603291200.gz",
+			time.Date(2026, 3, 29, 9, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		if got := Timestamp(test.name); got != test.want.Unix() {
+			t.Errorf("Timestamp(%q)=%v, want %v", test.name,
+				time.Unix(got, 0).UTC(), test.want)
+		}
+	}
+}
+
+func TestTimestampBad(t *testing.T) {
+	for _, name := range []string{"", "Stores7290027600007.xml",
+		"Price7290027600007-001-202613010000.gz",
+		"Price7290027600007-001-2026101703001.gz"} {
+		if got := Timestamp(name); got != -1 {
+			t.Errorf("Timestamp(%q)=%v, want -1", name, got)
+		}
+	}
+}
+
+func TestUseUTC(t *testing.T) {
+	defer func() { location = Israel }()
+	UseUTC()
+	name := "PriceFull7290027600007-001-202610170300.gz"
+	want := time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC).Unix()
+	if got := Timestamp(name); got != want {
+		t.Errorf("Timestamp(%q)=%v, want %v", name, got, want)
+	}
+}
+
+func TestDate(t *testing.T) {
+	// 22:30 UTC is already the next day in Israel.
+	ts := time.Date(2026, 10, 16, 22, 30, 0, 0, time.UTC).Unix()
+	if got := Date(ts); got != "2026-10-17" {
+		t.Errorf("Date(%v)=%q, want %q", ts, got, "2026-10-17")
+	}
+	day := Day(time.Unix(ts, 0))
+	want := time.Date(2026, 10, 17, 0, 0, 0, 0, Israel)
+	if !day.Equal(want) {
+		t.Errorf("Day(%v)=%v, want %v", ts, day, want)
+	}
+}
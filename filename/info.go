@@ -0,0 +1,116 @@
+package filename
+
+// Parsing of data file names.
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Kinds of data files, as they appear in file names.
+const (
+	Price     = "Price"
+	PriceFull = "PriceFull"
+	Promo     = "Promo"
+	PromoFull = "PromoFull"
+	Stores    = "Stores"
+)
+
+// Kinds are all kinds of data files.
+var Kinds = []string{Price, PriceFull, Promo, PromoFull, Stores}
+
+// Info is the information in the name of a data file.
+type Info struct {
+	Kind        string // One of Kinds.
+	Chain       string // Chain ID, 13 digits.
+	Subchain    string // Subchain ID as in the name. Empty if none.
+	Store       string // Store ID without leading zeros. Empty for stores files.
+	Time        int64  // Unix time of publishing.
+	Compression string // "gz", "zip", or empty for none, by the extension.
+}
+
+// infoPattern matches the names of data files. By the regulations they look
+// like PriceFull7290027600007-001-202610170300.gz. Some chains add a subchain
+// before the store, seconds to the time, or Full to stores files. Stores files
+// may have a store number of 000 or none.
+var infoPattern = regexp.MustCompile("(?i)^(PriceFull|PromoFull|Price|Promo|" +
+	"Stores(?:Full)?)(\\d{13})(?:-(\\d+))?(?:-(\\d+))?-(20\\d{10})(?:\\d{2})?" +
+	"(\\D|$)")
+
+// Parse returns the information in the name of a data file. Directories in the
+// path are ignored. Returns nil if the name is not of a data file.
+func Parse(file string) *Info {
+	base := filepath.Base(file)
+	match := infoPattern.FindStringSubmatch(base)
+	if match == nil {
+		return nil
+	}
+	t, ok := parseTime(match[5])
+	if !ok {
+		return nil
+	}
+
+	result := &Info{Kind: ParseKind(match[1]), Chain: match[2],
+		Time: t.Unix()}
+	if result.Kind == "" { // StoresFull.
+		result.Kind = Stores
+	}
+	store := match[3]
+	if match[4] != "" {
+		result.Subchain, store = match[3], match[4]
+	}
+	if result.Kind != Stores {
+		result.Store = StoreID(store)
+	}
+	switch strings.ToLower(filepath.Ext(base)) {
+	case ".gz":
+		result.Compression = "gz"
+	case ".zip":
+		result.Compression = "zip"
+	}
+	return result
+}
+
+// kindPattern matches the kind at the start of a data file's name.
+var kindPattern = regexp.MustCompile("(?i)^(PriceFull|PromoFull|Price|Promo|" +
+	"Stores(?:Full)?)\\d")
+
+// KindOf returns the kind of a data file from the start of its name. Unlike
+// Parse, it accepts names with no chain ID or timestamp. Directories in the
+// path are ignored. Returns an empty string if the name does not start with a
+// kind followed by a digit.
+func KindOf(file string) string {
+	match := kindPattern.FindStringSubmatch(filepath.Base(file))
+	if match == nil {
+		return ""
+	}
+	if kind := ParseKind(match[1]); kind != "" {
+		return kind
+	}
+	return Stores // StoresFull.
+}
+
+// ParseKind returns the kind in Kinds that equals s ignoring case, or an empty
+// string if none.
+func ParseKind(s string) string {
+	for _, kind := range Kinds {
+		if strings.EqualFold(s, kind) {
+			return kind
+		}
+	}
+	return ""
+}
+
+// StoreID returns the store ID without leading zeros, so that differently
+// padded IDs are equal.
+func StoreID(s string) string {
+	if s == "" {
+		return ""
+	}
+	s = strings.TrimLeft(s, "0")
+	if s == "" {
+		return "0"
+	}
+	return s
+}
@@ -0,0 +1,90 @@
+package filename
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	ts := time.Date(2026, 10, 17, 3, 0, 0, 0, Israel).Unix()
+	tests := []struct {
+		name string
+		want *Info
+	}{
+		// Shufersal.
+		{"PriceFull7290027600007-001-202610170300.gz",
+			&Info{PriceFull, "7290027600007", "", "1", ts, "gz"}},
+		{"Stores7290027600007-000-202610170300.xml",
+			&Info{Stores, "7290027600007", "", "", ts, ""}},
+		// Mega, with 4 digit stores.
+		{"Price7290055700007-0030-202610170300.gz",
+			&Info{Price, "7290055700007", "", "30", ts, "gz"}},
+		// Coop, plain XML.
+		{"PromoFull7290633800006-101-202610170300.xml",
+			&Info{PromoFull, "7290633800006", "", "101", ts, ""}},
+		// Nibit, in a directory per chain.
+		{"7290696200003/Promo7290696200003-046-202610170300.xml.gz",
+			&Info{Promo, "7290696200003", "", "46", ts, "gz"}},
+		// Zipped, with no store.
+		{"Stores7290055755557-202610170300.zip",
+			&Info{Stores, "7290055755557", "", "", ts, "zip"}},
+		// Lower case.
+		{"promofull7290058173198-001-202610170300.xml",
+			&Info{PromoFull, "7290058173198", "", "1", ts, ""}},
+		// With a subchain.
+		{"PriceFull7290172900007-001-215-202610170300.gz",
+			&Info{PriceFull, "7290172900007", "001", "215", ts, "gz"}},
+		{"StoresFull7290172900007-001-000-202610170300.xml",
+			&Info{Stores, "7290172900007", "001", "", ts, ""}},
+		// With seconds.
+		{"Price7290873255550-002-20261017030012.gz",
+			&Info{Price, "7290873255550", "", "2", ts, "gz"}},
+		// In a date directory.
+		{"2026-10-17/PriceFull7290027600007-000-202610170300.gz",
+			&Info{PriceFull, "7290027600007", "", "0", ts, "gz"}},
+
+		{"Prices7290027600007-001-202610170300.gz", nil},
+		{"PriceFull7290027600007-001.gz", nil},
+		{"PriceFull729002760000-001-202610170300.gz", nil},
+		{"PriceFull7290027600007-001-202613170300.gz", nil},
+		{"index.html", nil},
+	}
+	for _, test := range tests {
+		got := Parse(test.name)
+		if (got == nil) != (test.want == nil) ||
+			got != nil && *got != *test.want {
+			t.Errorf("Parse(%q)=%+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParseKind(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"PriceFull", PriceFull}, {"pricefull", PriceFull}, {"STORES", Stores},
+		{"Prices", ""}, {"", ""},
+	}
+	for _, test := range tests {
+		if got := ParseKind(test.s); got != test.want {
+			t.Errorf("ParseKind(%q)=%q, want %q", test.s, got, test.want)
+		}
+	}
+}
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"Stores1", Stores}, {"/a/Stores1", Stores}, {"Stores", ""},
+		{"StoresFull7290172900007", Stores}, {"pricefull7", PriceFull},
+		{"Prices1", ""}, {"a/Price", ""},
+	}
+	for _, test := range tests {
+		if got := KindOf(test.s); got != test.want {
+			t.Errorf("KindOf(%q)=%q, want %q", test.s, got, test.want)
+		}
+	}
+}
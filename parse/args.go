@@ -8,6 +8,7 @@ import (
 	"runtime"
 
 	"github.com/fluhus/gostuff/flug"
+	"github.com/fluhus/prices/filename"
 )
 
 var args struct {
@@ -17,6 +18,8 @@ var args struct {
 	OutDir      string `flug:"o,Output directory. Default is current."`
 	ForceRaw    bool   `flug:"f,Force parsing of raw files, instead of reading serialized data."`
 	NumThreads  int    `flug:"t,Number of threads to run on. Default is number of CPUs."`
+	Manifests   string `flug:"m,Comma separated scrape manifests. Input files that do not match their manifest entry are skipped."`
+	UTC         bool   `flug:"utc,Read times in file names as UTC, like versions before Israel time. For adding to tables made by those versions."`
 	Help        bool
 }
 
@@ -47,6 +50,10 @@ func parseArgs() {
 		os.Exit(1)
 	}
 
+	if args.UTC {
+		filename.UseUTC()
+	}
+
 	args.Files = flag.Args()
 	if len(args.Files) == 0 {
 		pe("No input files provided.")
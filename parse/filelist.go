@@ -6,11 +6,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
-	"strconv"
 	"strings"
-	"time"
+
+	"github.com/fluhus/prices/filename"
+	"github.com/fluhus/prices/scrape/manifest"
 )
 
 // TODO(amit): Consider extracting this to a separate package.
@@ -49,14 +49,25 @@ func organizeInputFiles() ([]*fileAndTime, error) {
 			if strings.HasSuffix(p, ".items") { // Ignore parsed intermediates.
 				continue
 			}
+			if strings.HasSuffix(p, ".part") { // Ignore unfinished downloads.
+				continue
+			}
 			paths[p] = struct{}{}
 		}
 	}
 
+	// Check files against scrape manifests.
+	if args.Manifests != "" {
+		err := checkManifests(paths)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Create timestamps.
 	var result []*fileAndTime
 	for p := range paths {
-		ts := fileTimestamp(p)
+		ts := filename.Timestamp(p)
 		if ts == -1 {
 			pe("Skipping file with no timestamp:", p)
 			continue
@@ -74,22 +85,35 @@ func organizeInputFiles() ([]*fileAndTime, error) {
 	return result, nil
 }
 
-// fileTimestamp infers the timestamp of a file according to its name. Returns -1 if failed.
-func fileTimestamp(file string) int64 {
-	match := regexp.MustCompile("(\\D|^)(20\\d{10})(\\D|$)").FindStringSubmatch(filepath.Base(file))
-	if match == nil || len(match[2]) != 12 {
-		return -1
+// checkManifests checks the given files against the manifests in
+// args.Manifests, and removes from paths files that do not match their
+// entries. Files with no entry are kept.
+func checkManifests(paths map[string]struct{}) error {
+	var entries []*manifest.Entry
+	for _, m := range strings.Split(args.Manifests, ",") {
+		e, err := manifest.Read(m)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, e...)
 	}
-	digits := match[2]
-	year, _ := strconv.ParseInt(digits[0:4], 10, 64)
-	month, _ := strconv.ParseInt(digits[4:6], 10, 64)
-	day, _ := strconv.ParseInt(digits[6:8], 10, 64)
-	hour, _ := strconv.ParseInt(digits[8:10], 10, 64)
-	minute, _ := strconv.ParseInt(digits[10:12], 10, 64)
-	t := time.Date(int(year), time.Month(month), int(day), int(hour),
-		int(minute), 0, 0, time.UTC)
+	latest := manifest.Latest(entries)
 
-	return t.Unix()
+	for p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return err
+		}
+		e := latest[abs]
+		if e == nil {
+			continue
+		}
+		if err := e.Check(); err != nil {
+			pe("Skipping file that does not match manifest:", err)
+			delete(paths, p)
+		}
+	}
+	return nil
 }
 
 // Represents a file and its timestamp.
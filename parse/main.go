@@ -6,12 +6,11 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"regexp"
 	"runtime"
-	"strings"
 	"sync"
 
 	"github.com/fluhus/gostuff/ezpprof"
+	"github.com/fluhus/prices/filename"
 	"github.com/fluhus/prices/parse/bouncer"
 	"github.com/fluhus/prices/parse/serializer"
 )
@@ -171,7 +170,7 @@ func parseFile(file string) error {
 
 	// Passing chain-ID because Co-Op don't include that field in their
 	// XMLs.
-	chainId := fileChainId(file)
+	chainId := filename.Parse(file).Chain
 	items, err := parsers[typ].parse(data, map[string]string{"chain_id": chainId})
 	if err != nil {
 		return fmt.Errorf("failed to parse file: %v", err)
@@ -219,30 +218,22 @@ func reportParsedFile(file string, tim int64) error {
 // Returns either "prices", "stores", "promos", or an empty string if cannot
 // infer.
 func fileType(file string) string {
-	base := filepath.Base(file)
-	switch {
-	case strings.HasPrefix(base, "Price"):
+	info := filename.Parse(file)
+	if info == nil {
+		return ""
+	}
+	switch info.Kind {
+	case filename.Price, filename.PriceFull:
 		return "prices"
-	case strings.HasPrefix(base, "Store"):
+	case filename.Stores:
 		return "stores"
-	case strings.HasPrefix(base, "Promo"):
+	case filename.Promo, filename.PromoFull:
 		return "promos"
 	default:
 		return ""
 	}
 }
 
-// fileChainId infers the chain-ID of a file according to its name. Returns an
-// empty string if failed.
-func fileChainId(file string) string {
-	match := regexp.MustCompile("\\D(7290\\d+)").FindStringSubmatch(file)
-	if match == nil || len(match[1]) != 13 {
-		return ""
-	}
-
-	return match[1]
-}
-
 // fileExists checks if a file or directory exists.
 func fileExists(f string) bool {
 	_, err := os.Stat(f)
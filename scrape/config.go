@@ -0,0 +1,235 @@
+package main
+
+// Chain configuration, read from a JSON chains file.
+//
+// A chains file looks like this:
+//
+//	{
+//		"chains": [
+//			{"name": "tivtaam", "kind": "cerberus", "username": "TivTaam",
+//				"chain_id": "7290873255550", "site": "https://url.publishedprices.co.il/"},
+//			{"name": "victory", "kind": "nibit", "chain_id": "7290696200003", "days": 7},
+//			{"name": "matrix", "kind": "nibit", "all_chains": true, "days": 1},
+//			{"name": "mega", "kind": "index", "home": "http://publishprice.mega.co.il/",
+//				"dirs": "^2\\d{7}/$", "files": "\\.(gz|xml)$", "date_dir": "20060102", "depth": 1},
+//			{"name": "eden", "kind": "linkpage", "page": "http://operations.edenteva.co.il/Prices/index",
+//				"files": "\\.zip$"},
+//			{"name": "newchain", "enabled": false, "chain_id": "7290000000017"}
+//		]
+//	}
+//
+// Disabled chains are placeholders, compared with the authority's chain list
+// but not scraped. Chains are matched with the list by their chain IDs, and
+// their sites are compared if given. Passwords can be given inline, or read
+// from an environment variable or a file. A nibit chain with all_chains scrapes
+// every chain on the portal, and reports chains whose IDs are not in the file.
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fluhus/prices/scrape/scrapers"
+)
+
+// The built-in chains file, used when no other file is given.
+//
+//go:embed chains.json
+var defaultChains []byte
+
+// Holds tasks to perform by the main program, by chain name. Tasks will be
+// performed ordered by flag value, or alphabetically if chains flag is empty.
+// Placeholders have a nil value.
+var tasks = map[string]scrapers.Scraper{}
+
+// Number of download threads by chain name, for chains that do not use the
+// threads flag.
+var chainThreads = map[string]int{}
+
+// Request timeouts by chain name, for chains that do not use the httptimeouts
+// flag.
+var chainTimeouts = map[string]scrapers.Timeouts{}
+
+// Configs of all chains by name, including placeholders.
+var chainConfigs = map[string]*chainConfig{}
+
+// The content of a chains file.
+type chainsFile struct {
+	Chains []*chainConfig `json:"chains"`
+}
+
+// Configures a single chain.
+type chainConfig struct {
+	Name         string `json:"name"`          // As given in the chains flag.
+	Kind         string `json:"kind"`          // Scraper kind, see newScraper.
+	Enabled      *bool  `json:"enabled"`       // Default true.
+	Threads      int    `json:"threads"`       // Default the threads flag.
+	Timeouts     string `json:"timeouts"`      // Default the httptimeouts flag.
+	Username     string `json:"username"`      // For cerberus.
+	Password     string `json:"password"`      // For cerberus, inline.
+	PasswordEnv  string `json:"password_env"`  // For cerberus, from environment.
+	PasswordFile string `json:"password_file"` // For cerberus, from file.
+	ChainID      string `json:"chain_id"`      // GS1 code, for nibit and chain checks.
+	Site         string `json:"site"`          // Publishing site, for chain checks.
+	Days         int    `json:"days"`          // For nibit, days back from today.
+	AllChains    bool   `json:"all_chains"`    // For nibit, all chains on the portal.
+	Home         string `json:"home"`          // For index, top listing URL.
+	Dirs         string `json:"dirs"`          // For index, directory link pattern.
+	Files        string `json:"files"`         // For index and linkpage, file link pattern.
+	DateDir      string `json:"date_dir"`      // For index, date directory layout.
+	Depth        int    `json:"depth"`         // For index, directory levels.
+	Page         string `json:"page"`          // For linkpage, file list URL.
+	Links        string `json:"links"`         // For linkpage, link selector.
+	Download     string `json:"download"`      // For linkpage, base of relative links.
+
+	dir   string   // Directory of the chains file, for relative paths.
+	known []string // Chain IDs of all chains in the file.
+}
+
+// Reads the given chains file, or the built-in one if file is empty, and sets
+// the tasks accordingly.
+func loadChains(file string) error {
+	data, dir := defaultChains, "."
+	if file != "" {
+		var err error
+		data, err = ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		dir = filepath.Dir(file)
+	}
+
+	var f chainsFile
+	err := json.Unmarshal(data, &f)
+	if err != nil {
+		return fmt.Errorf("bad chains file: %v", err)
+	}
+	if len(f.Chains) == 0 {
+		return fmt.Errorf("bad chains file: no chains")
+	}
+
+	var known []string
+	for _, c := range f.Chains {
+		if c.ChainID != "" {
+			known = append(known, c.ChainID)
+		}
+	}
+
+	for _, c := range f.Chains {
+		if c.Name == "" {
+			return fmt.Errorf("bad chains file: chain with no name")
+		}
+		if _, ok := tasks[c.Name]; ok {
+			return fmt.Errorf("bad chains file: duplicate chain %q", c.Name)
+		}
+		if c.Threads < 0 {
+			return fmt.Errorf("chain %q: bad number of threads: %d", c.Name,
+				c.Threads)
+		}
+		chainConfigs[c.Name] = c
+		if c.Enabled != nil && !*c.Enabled {
+			tasks[c.Name] = nil
+			continue
+		}
+		c.dir, c.known = dir, known
+		scrp, err := c.newScraper()
+		if err != nil {
+			return fmt.Errorf("chain %q: %v", c.Name, err)
+		}
+		tasks[c.Name] = scrp
+		chainThreads[c.Name] = c.Threads
+		if c.Timeouts != "" {
+			t, err := scrapers.ParseTimeouts(c.Timeouts)
+			if err != nil {
+				return fmt.Errorf("chain %q: %v", c.Name, err)
+			}
+			chainTimeouts[c.Name] = t
+		}
+	}
+
+	return nil
+}
+
+// Returns the scraper that the config describes.
+func (c *chainConfig) newScraper() (scrapers.Scraper, error) {
+	switch c.Kind {
+	case "cerberus":
+		if c.Username == "" {
+			return nil, fmt.Errorf("missing username")
+		}
+		password, err := c.password()
+		if err != nil {
+			return nil, err
+		}
+		return scrapers.Cerberus(c.Username, password), nil
+	case "nibit":
+		if c.ChainID == "" && !c.AllChains {
+			return nil, fmt.Errorf("missing chain_id")
+		}
+		if c.ChainID != "" && c.AllChains {
+			return nil, fmt.Errorf("chain_id cannot be used with all_chains")
+		}
+		if c.Days < 1 {
+			return nil, fmt.Errorf("bad number of days: %d, must be positive",
+				c.Days)
+		}
+		if c.AllChains {
+			return scrapers.NibitAll(c.Days, c.known), nil
+		}
+		return scrapers.Nibit(c.ChainID, c.Days), nil
+	case "shufersal":
+		return scrapers.Shufersal(), nil
+	case "index":
+		return scrapers.Index(scrapers.IndexConfig{Home: c.Home, Dirs: c.Dirs,
+			Files: c.Files, DateDir: c.DateDir, Depth: c.Depth})
+	case "linkpage":
+		return scrapers.LinkPage(scrapers.LinkPageConfig{Page: c.Page,
+			Links: c.Links, Files: c.Files, Download: c.Download})
+	case "coop":
+		return scrapers.Coop(), nil
+	case "":
+		return nil, fmt.Errorf("missing kind")
+	default:
+		return nil, fmt.Errorf("unknown kind: %q", c.Kind)
+	}
+}
+
+// Returns the configured password, or an empty string if none.
+func (c *chainConfig) password() (string, error) {
+	n := 0
+	for _, s := range []string{c.Password, c.PasswordEnv, c.PasswordFile} {
+		if s != "" {
+			n++
+		}
+	}
+	if n > 1 {
+		return "", fmt.Errorf("only one of password, password_env and " +
+			"password_file may be given")
+	}
+
+	switch {
+	case c.PasswordEnv != "":
+		password, ok := os.LookupEnv(c.PasswordEnv)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set",
+				c.PasswordEnv)
+		}
+		return password, nil
+	case c.PasswordFile != "":
+		file := c.PasswordFile
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(c.dir, file)
+		}
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	default:
+		return c.Password, nil
+	}
+}
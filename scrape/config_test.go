@@ -0,0 +1,79 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fluhus/prices/scrape/scrapers"
+)
+
+func TestLoadChains(t *testing.T) {
+	defer func() {
+		tasks = map[string]scrapers.Scraper{}
+		chainThreads = map[string]int{}
+		chainTimeouts = map[string]scrapers.Timeouts{}
+		chainConfigs = map[string]*chainConfig{}
+	}()
+
+	if err := loadChains(""); err != nil {
+		t.Fatalf("loadChains(\"\") failed: %v", err)
+	}
+	if len(tasks) == 0 {
+		t.Fatalf("loadChains(\"\") loaded no chains")
+	}
+
+	dir := t.TempDir()
+	ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("s3cret\n"), 0600)
+	file := filepath.Join(dir, "chains.json")
+	ioutil.WriteFile(file, []byte(`{"chains": [
+		{"name": "a", "kind": "cerberus", "username": "A",
+			"password_file": "secret", "threads": 2, "timeouts": "//2m"},
+		{"name": "b", "kind": "cerberus", "username": "B",
+			"password_env": "TEST_CHAIN_PASSWORD"},
+		{"name": "c", "kind": "nosuchkind", "enabled": false}
+	]}`), 0600)
+	os.Setenv("TEST_CHAIN_PASSWORD", "p4ss")
+	defer os.Unsetenv("TEST_CHAIN_PASSWORD")
+
+	tasks = map[string]scrapers.Scraper{}
+	if err := loadChains(file); err != nil {
+		t.Fatalf("loadChains(%q) failed: %v", file, err)
+	}
+	if len(tasks) != 3 || tasks["a"] == nil || tasks["b"] == nil ||
+		tasks["c"] != nil {
+		t.Errorf("loadChains(%q) set tasks %v, want a, b and placeholder c",
+			file, tasks)
+	}
+	if chainThreads["a"] != 2 {
+		t.Errorf("loadChains(%q) set threads %v, want a=2", file,
+			chainThreads)
+	}
+	if to, ok := chainTimeouts["a"]; !ok || to.Idle != 2*time.Minute ||
+		to.Connect != scrapers.DefaultTimeouts.Connect {
+		t.Errorf("loadChains(%q) set timeouts %v, want a with idle 2m",
+			file, chainTimeouts)
+	}
+
+	tests := []struct {
+		c       chainConfig
+		want    string
+		wantErr bool
+	}{
+		{chainConfig{Password: "inline"}, "inline", false},
+		{chainConfig{PasswordEnv: "TEST_CHAIN_PASSWORD"}, "p4ss", false},
+		{chainConfig{PasswordFile: "secret", dir: dir}, "s3cret", false},
+		{chainConfig{PasswordEnv: "TEST_NO_SUCH_VARIABLE"}, "", true},
+		{chainConfig{Password: "a", PasswordEnv: "TEST_CHAIN_PASSWORD"}, "",
+			true},
+	}
+	for i, test := range tests {
+		got, err := test.c.password()
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("#%v: password()=%q,%v want %q,error=%v", i+1, got, err,
+				test.want, test.wantErr)
+		}
+	}
+}
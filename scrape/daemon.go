@@ -0,0 +1,186 @@
+package main
+
+// Daemon mode, where chains are scraped repeatedly on a schedule.
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fluhus/prices/scrape/scrapers"
+)
+
+// Default interval between runs of a chain in daemon mode.
+const defaultEvery = time.Hour
+
+// A scheduleEntry is one of a chain's schedules in daemon mode.
+type scheduleEntry struct {
+	every time.Duration // Interval between runs.
+	types []string      // File types to download, nil for the types flag.
+}
+
+// Returns the name of the entry's runs in the log and the summary.
+func (e *scheduleEntry) name(chain string) string {
+	if e.types == nil {
+		return chain
+	}
+	return chain + ":" + strings.Join(e.types, "+")
+}
+
+// Scrapes each chain repeatedly until ctx is done. Every schedule entry runs
+// in its own loop, and at most args.Parallel chains are scraped at the same
+// time. Runs of the same chain never overlap, also when it has several
+// entries, since they share the chain's scraper. Scrapers are kept between
+// runs, so their clients and login sessions are reused.
+//
+// The summary file is rewritten after every run, with the latest run of each
+// schedule entry.
+func runDaemon(ctx context.Context, summaryFile string, diff *chainsDiff) {
+	log.Printf("Starting daemon mode.")
+	summary := &runSummary{Start: time.Now(), ChainCheck: diff}
+	var summaryLock sync.Mutex
+
+	slots := make(chan struct{}, args.Parallel)
+	var wait sync.WaitGroup
+	for _, chain := range args.ChainList {
+		if tasks[chain] == nil {
+			continue
+		}
+		entries := args.schedule[chain]
+		if len(entries) == 0 {
+			entries = []*scheduleEntry{{every: args.every}}
+		}
+		busy := make(chan struct{}, 1) // Held while the chain runs.
+		for _, entry := range entries {
+			wait.Add(1)
+			go func(chain string, entry *scheduleEntry) {
+				defer wait.Done()
+				name := entry.name(chain)
+				for {
+					// Wait for the chain to be free, then for a free slot.
+					select {
+					case busy <- struct{}{}:
+					case <-ctx.Done():
+						return
+					}
+					select {
+					case slots <- struct{}{}:
+					case <-ctx.Done():
+						<-busy
+						return
+					}
+					start := time.Now()
+					cs := scrapeChain(entryContext(ctx, entry), chain)
+					<-slots
+					<-busy
+
+					// A run cut by shutdown is not reported.
+					if ctx.Err() != nil {
+						return
+					}
+
+					cs.Types = entry.types
+					summaryLock.Lock()
+					summary.set(cs)
+					summary.Duration = time.Since(summary.Start).Seconds()
+					err := summary.write(summaryFile)
+					summaryLock.Unlock()
+					if err != nil {
+						log.Printf("Error writing summary: %v", err)
+					}
+
+					next := start.Add(entry.every)
+					log.Printf("%s Next run at %s.", name,
+						next.Format("2006-01-02 15:04:05"))
+					select {
+					case <-time.After(time.Until(next)):
+					case <-ctx.Done():
+						return
+					}
+				}
+			}(chain, entry)
+		}
+	}
+	wait.Wait()
+
+	log.Printf("Daemon stopped: %v", ctx.Err())
+}
+
+// Returns a context for the runs of a schedule entry, that limits the file
+// types if the entry has its own.
+func entryContext(ctx context.Context, entry *scheduleEntry) context.Context {
+	if entry.types == nil {
+		return ctx
+	}
+	// Types were checked when parsing the schedule.
+	ctx, _ = scrapers.WithFileTypes(ctx, entry.types)
+	return ctx
+}
+
+// Parses the daemon's intervals from the every and schedule flags.
+func parseSchedule() error {
+	args.every = defaultEvery
+	if args.Every != "" {
+		d, err := parseInterval(args.Every)
+		if err != nil {
+			return fmt.Errorf("bad interval: %v", err)
+		}
+		args.every = d
+	}
+
+	args.schedule = map[string][]*scheduleEntry{}
+	if args.Schedule == "" {
+		return nil
+	}
+	for _, entry := range strings.Split(args.Schedule, ",") {
+		chain, e, err := parseScheduleEntry(entry)
+		if err != nil {
+			return fmt.Errorf("bad schedule entry: %q: %v", entry, err)
+		}
+		args.schedule[chain] = append(args.schedule[chain], e)
+	}
+	return nil
+}
+
+// Parses a chain=interval or chain:Type+Type=interval schedule entry. Returns
+// the chain and its entry.
+func parseScheduleEntry(s string) (string, *scheduleEntry, error) {
+	parts := strings.Split(s, "=")
+	if len(parts) != 2 {
+		return "", nil, fmt.Errorf("expected %q or %q", "chain=interval",
+			"chain:Type+Type=interval")
+	}
+	chain := parts[0]
+	var types []string
+	if i := strings.Index(chain, ":"); i != -1 {
+		types = strings.Split(chain[i+1:], "+")
+		chain = chain[:i]
+		if _, err := scrapers.WithFileTypes(context.Background(),
+			types); err != nil {
+			return "", nil, err
+		}
+	}
+	if _, ok := tasks[chain]; !ok {
+		return "", nil, fmt.Errorf("unrecognized chain name: %q", chain)
+	}
+	d, err := parseInterval(parts[1])
+	if err != nil {
+		return "", nil, err
+	}
+	return chain, &scheduleEntry{every: d, types: types}, nil
+}
+
+// Parses a positive duration.
+func parseInterval(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("interval must be positive: %v", d)
+	}
+	return d, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fluhus/prices/scrape/scrapers"
+)
+
+func TestParseScheduleEntry(t *testing.T) {
+	defer func(t map[string]scrapers.Scraper) { tasks = t }(tasks)
+	tasks = map[string]scrapers.Scraper{"a": nil}
+
+	tests := []struct {
+		s       string
+		want    *scheduleEntry
+		wantErr bool
+	}{
+		{"a=1h", &scheduleEntry{every: time.Hour}, false},
+		{"a:Price+promofull=30m", &scheduleEntry{every: 30 * time.Minute,
+			types: []string{"Price", "promofull"}}, false},
+		{"a:=1h", nil, true},
+		{"a:Prices=1h", nil, true},
+		{"b=1h", nil, true},
+		{"a=-1h", nil, true},
+		{"a", nil, true},
+	}
+	for i, test := range tests {
+		chain, got, err := parseScheduleEntry(test.s)
+		if (err != nil) != test.wantErr {
+			t.Errorf("#%v: parseScheduleEntry(%q) error=%v, want error=%v",
+				i+1, test.s, err, test.wantErr)
+			continue
+		}
+		if err == nil && (chain != "a" || !reflect.DeepEqual(got, test.want)) {
+			t.Errorf("#%v: parseScheduleEntry(%q)=%q,%+v want %q,%+v", i+1,
+				test.s, chain, got, "a", test.want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+// Comparison of the chains on the authority's page with the configured ones.
+
+import (
+	"context"
+	"log"
+	urllib "net/url"
+	"sort"
+	"strings"
+
+	"github.com/fluhus/prices/scrape/scrapers"
+)
+
+// Differences between the chains on the authority's page and the configured
+// chains. Chains are matched by their chain IDs.
+type chainsDiff struct {
+	New       []*scrapers.ChainInfo `json:"new"`       // Listed but not configured.
+	Missing   []string              `json:"missing"`   // Configured but not listed.
+	Changed   []*chainChange        `json:"changed"`   // Listed with another site.
+	Unchecked []string              `json:"unchecked"` // Configured with no chain ID.
+}
+
+// A configured chain whose site differs from the listed one.
+type chainChange struct {
+	Chain string `json:"chain"` // Configured name.
+	Site  string `json:"site"`  // Configured site.
+	URL   string `json:"url"`   // Listed site.
+}
+
+// Returns the differences between the listed chains and the configured ones.
+// Sites are compared by host, since chains list different pages of the same
+// site.
+func diffChains(listed []*scrapers.ChainInfo,
+	configs map[string]*chainConfig) *chainsDiff {
+	result := &chainsDiff{}
+	byID := map[string]*scrapers.ChainInfo{}
+	for _, info := range listed {
+		byID[info.ID] = info
+	}
+
+	configured := map[string]bool{}
+	for _, c := range configs {
+		if c.AllChains {
+			continue // Not a single chain.
+		}
+		if c.ChainID == "" {
+			result.Unchecked = append(result.Unchecked, c.Name)
+			continue
+		}
+		configured[c.ChainID] = true
+		info := byID[c.ChainID]
+		if info == nil {
+			result.Missing = append(result.Missing, c.Name)
+			continue
+		}
+		if c.Site != "" && siteHost(c.Site) != siteHost(info.URL) {
+			result.Changed = append(result.Changed,
+				&chainChange{c.Name, c.Site, info.URL})
+		}
+	}
+	for _, info := range listed {
+		if !configured[info.ID] {
+			result.New = append(result.New, info)
+		}
+	}
+
+	sort.Strings(result.Missing)
+	sort.Strings(result.Unchecked)
+	sort.Slice(result.Changed, func(i, j int) bool {
+		return result.Changed[i].Chain < result.Changed[j].Chain
+	})
+	return result
+}
+
+// Returns the lower-case host of the given URL, without "www.". Returns the
+// URL as is if it cannot be parsed.
+func siteHost(url string) string {
+	u, err := urllib.Parse(url)
+	if err != nil || u.Host == "" {
+		return url
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// Returns true if the diff has no differences. Unchecked chains are not
+// differences.
+func (d *chainsDiff) empty() bool {
+	return len(d.New) == 0 && len(d.Missing) == 0 && len(d.Changed) == 0
+}
+
+// Logs the differences.
+func (d *chainsDiff) log() {
+	for _, info := range d.New {
+		log.Printf("Chain check: New chain %q (ID %s) at %s. Add it, or add"+
+			" a disabled placeholder with its chain_id to the chains file.",
+			info.Name, info.ID, info.URL)
+	}
+	for _, chain := range d.Missing {
+		log.Printf("Chain check: Chain %s is no longer listed.", chain)
+	}
+	for _, c := range d.Changed {
+		log.Printf("Chain check: Chain %s moved from %s to %s.", c.Chain,
+			c.Site, c.URL)
+	}
+	if len(d.Unchecked) > 0 {
+		log.Printf("Chain check: Chains with no chain_id were not checked: %s",
+			strings.Join(d.Unchecked, ", "))
+	}
+	if d.empty() {
+		log.Printf("Chain check: All listed chains are configured.")
+	}
+}
+
+// Compares the chains on the authority's page with the configured ones, and
+// logs the differences. Returns nil if the page could not be checked.
+func checkChains(ctx context.Context) *chainsDiff {
+	listed, err := scrapers.ListChains(ctx)
+	if err != nil {
+		log.Printf("Chain check error: %v", err)
+		return nil
+	}
+	diff := diffChains(listed, chainConfigs)
+	diff.log()
+	return diff
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fluhus/prices/scrape/scrapers"
+)
+
+func TestDiffChains(t *testing.T) {
+	listed := []*scrapers.ChainInfo{
+		{Name: "שופרסל", ID: "7290027600007",
+			URL: "http://prices.shufersal.co.il/"},
+		{Name: "טיב טעם", ID: "7290873255550",
+			URL: "https://url.publishedprices.co.il/login"},
+		{Name: "ויקטורי", ID: "7290696200003",
+			URL: "http://www.victory.co.il/prices"},
+		{Name: "רשת חדשה", ID: "7290000000017",
+			URL: "http://prices.newchain.co.il/"},
+	}
+	configs := map[string]*chainConfig{
+		"shufersal": {Name: "shufersal", ChainID: "7290027600007",
+			Site: "http://PRICES.shufersal.co.il/FileObject"},
+		"tivtaam": {Name: "tivtaam", ChainID: "7290873255550"},
+		"victory": {Name: "victory", ChainID: "7290696200003",
+			Site: "http://matrixcatalog.co.il/"},
+		"mega":      {Name: "mega", ChainID: "7290055700007"},
+		"superdosh": {Name: "superdosh"},
+	}
+
+	got := diffChains(listed, configs)
+	want := &chainsDiff{
+		New:     []*scrapers.ChainInfo{listed[3]},
+		Missing: []string{"mega"},
+		Changed: []*chainChange{{"victory", "http://matrixcatalog.co.il/",
+			"http://www.victory.co.il/prices"}},
+		Unchecked: []string{"superdosh"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("diffChains(...)=%+v want %+v", got, want)
+	}
+	if got.empty() {
+		t.Errorf("empty()=true want false")
+	}
+}
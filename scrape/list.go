@@ -0,0 +1,97 @@
+package main
+
+// Listing of the files chains publish, without downloading them.
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fluhus/prices/scrape/scrapers"
+)
+
+// Values for the format flag.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// A file in the listing's JSON output.
+type listedFile struct {
+	Chain string `json:"chain"`
+	*scrapers.RemoteFile
+}
+
+// Runs the listing step of each chain and prints the files to stdout. Nothing
+// is written to disk. Returns the program's exit code.
+func runList() int {
+	ctx, stop := runContext()
+	defer stop()
+
+	summary := &runSummary{Start: time.Now()}
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	if args.Format == formatTable {
+		fmt.Fprintln(table, "CHAIN\tNAME\tSIZE\tTIME\tURL")
+	}
+	enc := json.NewEncoder(out)
+
+	for _, chain := range args.ChainList {
+		scrp := tasks[chain]
+		if scrp == nil {
+			continue
+		}
+
+		t := time.Now()
+		cs := &chainSummary{Chain: chain, Status: statusOK}
+		files, err := listChain(ctx, chain, scrp)
+		cs.Duration = time.Since(t).Seconds()
+		if err != nil {
+			log.Printf("%s Failed to list files: %v", chain, err)
+			cs.Status = statusFailed
+			cs.Error = err.Error()
+			summary.add(cs)
+			continue
+		}
+		log.Printf("%s Found %d files.", chain, len(files))
+		cs.Listed = len(files)
+		summary.add(cs)
+
+		sort.Slice(files, func(i, j int) bool {
+			return files[i].Name < files[j].Name
+		})
+		for _, file := range files {
+			if args.Format == formatJSON {
+				enc.Encode(&listedFile{chain, file})
+				continue
+			}
+			size, tm := "-", "-"
+			if file.Size > 0 {
+				size = fmt.Sprint(file.Size)
+			}
+			if !file.Time.IsZero() {
+				tm = file.Time.Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", chain, file.Name,
+				size, tm, file.URL)
+		}
+	}
+	table.Flush()
+
+	return summary.exitCode()
+}
+
+// Returns the files of a single chain, with the chain's settings.
+func listChain(ctx context.Context, chain string,
+	scrp scrapers.Scraper) ([]*scrapers.RemoteFile, error) {
+	ctx, cancel := chainContext(ctx, chain)
+	defer cancel()
+	return scrp.List(ctx)
+}
@@ -3,132 +3,347 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/fluhus/gostuff/flug"
+	"github.com/fluhus/prices/scrape/manifest"
 	"github.com/fluhus/prices/scrape/scrapers"
 )
 
 func main() {
+	os.Exit(run())
+}
+
+// Performs the scraping and returns the program's exit code. Separated from
+// main so that deferred calls run before exiting.
+func run() int {
 	// Parse arguments.
 	err := parseArgs()
 	if err == noArgs {
 		fmt.Fprintln(os.Stderr, help)
 		flag.PrintDefaults()
 		fmt.Fprintln(os.Stderr, "\n"+credit)
-		os.Exit(1)
+		return exitUsage
 	}
 	if err != nil {
-		log.Fatal("Failed to parse arguments: ", err)
+		log.Print("Failed to parse arguments: ", err)
+		return exitUsage
+	}
+
+	// Listing writes nothing to disk, so it needs no output dir.
+	if args.List {
+		return runList()
 	}
 
 	// Open logging output file.
+	logsDir := filepath.Join(args.Dir, "logs")
+	err = os.MkdirAll(logsDir, 0700)
+	if err != nil {
+		log.Print("Filed to create output dir:", err)
+		return exitUsage
+	}
 	if !args.Stdout {
-		logsDir := filepath.Join(args.Dir, "logs")
-		err = os.MkdirAll(logsDir, 0700)
+		out, err := os.OpenFile(filepath.Join(logsDir, logFileName()),
+			os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
 		if err != nil {
-			log.Fatal("Filed to create output dir:", err)
-		}
-		out, err := os.Create(filepath.Join(logsDir, logFileName()))
-		if err != nil {
-			log.Fatal("Error creating log file:", err)
+			log.Print("Error creating log file:", err)
+			return exitUsage
 		}
 		defer out.Close()
-		buf := bufio.NewWriter(out)
-		defer buf.Flush()
-		log.SetOutput(buf)
+		if args.Daemon {
+			// A daemon's log should be readable while it runs.
+			log.SetOutput(out)
+		} else {
+			buf := bufio.NewWriter(out)
+			defer buf.Flush()
+			log.SetOutput(buf)
+		}
 	}
 
 	logWelcome()
 
-	// Check that number of chains matches number of tasks.
-	chainCount, err := scrapers.CountChains()
-	if err != nil {
-		log.Printf("Chain count error: %v", err)
-	} else {
-		if chainCount != len(tasks) {
-			// TODO(amit): Improve this error message.
-			log.Printf("Chain count error: Found %d chains but there are %d"+
-				" tasks. To silence this error, place a nil placeholder"+
-				" in the task list.", chainCount, len(tasks))
+	// Check files of previous runs, before this run's manifest is created.
+	quarantineDir := filepath.Join(args.Dir, "quarantine")
+	known := readManifests(logsDir)
+	if args.Verify {
+		verifyManifests(known, quarantineDir)
+	}
+	scrapers.SetKnownFiles(known)
+
+	// Check downloaded files.
+	if args.Validate {
+		err := scrapers.SetValidation(scrapers.Validation{
+			MinSize:    args.MinSize,
+			Quarantine: quarantineDir,
+		})
+		if err != nil {
+			log.Print("Bad validation settings: ", err)
+			return exitUsage
 		}
 	}
 
-	// Perform scraping tasks.
+	// Keep pages that scrapers fail to parse.
+	scrapers.SetFailuresDir(filepath.Join(logsDir, "failures"))
+
+	// Record this run's files.
+	mf, err := manifest.Create(filepath.Join(logsDir, manifestFileName()))
+	if err != nil {
+		log.Print("Error creating manifest file:", err)
+		return exitUsage
+	}
+	defer mf.Close()
+	scrapers.SetManifest(mf)
+
+	ctx, stop := runContext()
+	defer stop()
+
+	// Check that the listed chains match the configured ones.
+	diff := checkChains(ctx)
+
+	// Determine where to report.
+	summaryFile := args.Summary
+	if summaryFile == "" {
+		summaryFile = filepath.Join(logsDir, summaryFileName())
+	}
+
+	if args.Daemon {
+		runDaemon(ctx, summaryFile, diff)
+		return exitOK
+	}
+
+	// Perform scraping tasks, several chains at a time. Chains that share a
+	// host are throttled together by the scrapers' host limits.
 	t := time.Now()
+	summary := &runSummary{Start: t, ChainCheck: diff}
 
+	chains := make(chan string)
+	var wait sync.WaitGroup
+	var summaryLock sync.Mutex
+	for i := 0; i < args.Parallel; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for chain := range chains {
+				cs := scrapeChain(ctx, chain)
+				summaryLock.Lock()
+				summary.add(cs)
+				summaryLock.Unlock()
+			}
+		}()
+	}
 	for _, chain := range args.ChainList {
-		scrp := tasks[chain]
+		chains <- chain
+	}
+	close(chains)
+	wait.Wait()
 
-		// A task may be nil, to make a placeholder for a future scraper.
-		if scrp == nil {
-			continue
-		}
+	log.Printf("Operation is complete. Time took: %v", time.Now().Sub(t))
 
-		tt := time.Now()
-		log.SetPrefix(chain + " ")
-		log.Printf("Starting %s.", chain)
+	// Report.
+	summary.Duration = time.Since(t).Seconds()
+	err = summary.write(summaryFile)
+	if err != nil {
+		log.Printf("Error writing summary: %v", err)
+	}
+	log.Printf("%d chains succeeded, %d failed.", summary.Succeeded,
+		summary.Failed)
 
-		err := scrp.Scrape(filepath.Join(args.Dir, "{{date}}", chain))
-		if err != nil {
-			log.Printf("Finished with error: %v", err)
-		} else {
-			log.Printf("Finished successfully.")
-		}
+	return summary.exitCode()
+}
 
-		log.Println("Time took:", time.Now().Sub(tt))
-		log.SetPrefix("")
+// Returns a context that stops everything on interrupt or when the run's
+// deadline passes. The returned function releases the context's resources.
+func runContext() (context.Context, func()) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt,
+		syscall.SIGTERM)
+	if args.timeout <= 0 {
+		return ctx, stop
+	}
+	ctx, cancel := context.WithTimeout(ctx, args.timeout)
+	return ctx, func() {
+		cancel()
+		stop()
 	}
+}
 
-	log.Printf("Operation is complete. Time took: %v", time.Now().Sub(t))
+// Returns a context for scraping the given chain, with the chain's name,
+// threads and timeouts. The returned function releases the context's resources.
+func chainContext(ctx context.Context, chain string) (context.Context,
+	context.CancelFunc) {
+	ctx = scrapers.WithChain(ctx, chain)
+	if n := chainThreads[chain]; n > 0 {
+		ctx = scrapers.WithThreads(ctx, n)
+	}
+	if t, ok := chainTimeouts[chain]; ok {
+		ctx = scrapers.WithTimeouts(ctx, t)
+	}
+	if args.chainTimeout > 0 {
+		return context.WithTimeout(ctx, args.chainTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// Runs a single chain's scraper and logs the outcome. Returns nil for
+// placeholder tasks.
+func scrapeChain(ctx context.Context, chain string) *chainSummary {
+	scrp := tasks[chain]
+
+	// A task may be nil, to make a placeholder for a future scraper.
+	if scrp == nil {
+		return nil
+	}
+
+	// Don't start new chains after the run was stopped.
+	if ctx.Err() != nil {
+		log.Printf("%s Skipping: %v", chain, ctx.Err())
+		return &chainSummary{Chain: chain, Status: statusFailed,
+			Error: ctx.Err().Error()}
+	}
+
+	tt := time.Now()
+	log.Printf("%s Starting %s.", chain, chain)
+
+	stats := &scrapers.Stats{}
+	ctx, cancel := chainContext(scrapers.WithStats(ctx, stats), chain)
+	defer cancel()
+
+	result := &chainSummary{Chain: chain, Status: statusOK}
+	err := scrp.Scrape(ctx, filepath.Join(args.Dir, "{{date}}", chain))
+	if err != nil {
+		log.Printf("%s Finished with error: %v", chain, err)
+		result.Status = statusFailed
+		result.Error = err.Error()
+	} else {
+		log.Printf("%s Finished successfully.", chain)
+	}
+
+	log.Printf("%s Time took: %v", chain, time.Now().Sub(tt))
+	result.Duration = time.Since(tt).Seconds()
+	result.StatsSnapshot = stats.Snapshot()
+	return result
 }
 
-// Holds tasks to perform by the main program. Tasks will be performed ordered
-// by flag value, or alphabetically if chains flag is empty.
-//
-// Use a nil value to make a placeholder, for chain counting.
-var tasks = map[string]scrapers.Scraper{
-	"tivtaam":     scrapers.Cerberus("TivTaam", ""),
-	"shufersal":   scrapers.Shufersal(),
-	"doralon":     scrapers.Cerberus("DorAlon", ""),
-	"osherad":     scrapers.Cerberus("osherad", ""),
-	"mega":        scrapers.Mega(),
-	"hazihinam":   scrapers.Cerberus("HaziHinam", ""),
-	"keshet":      scrapers.Cerberus("Keshet", ""),
-	"ramilevi":    scrapers.Cerberus("RamiLevi", ""),
-	"superdosh":   scrapers.Cerberus("SuperDosh", ""),
-	"yohananof":   scrapers.Cerberus("Yohananof", ""),
-	"eden":        scrapers.Eden(),
-	"bitan":       scrapers.Bitan(),
-	"victory":     scrapers.Nibit(scrapers.Victory, 7),
-	"hashook":     scrapers.Nibit(scrapers.Hashook, 7),
-	"lahav":       scrapers.Nibit(scrapers.Lahav, 7),
-	"coop":        scrapers.Coop(),
-	"freshmarket": scrapers.Cerberus("freshmarket_sn", "f_efrd"),
-	"zolbegadol":  scrapers.Zolbegadol(),
-}
-
-// Returns the name that should be given to the log file.
+// Returns the name that should be given to the log file. Names go down to the
+// second, so that each run gets its own file.
 func logFileName() string {
 	t := time.Now()
-	return fmt.Sprintf("Log-%d%02d%02d%02d%02d.txt",
-		t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute())
+	return fmt.Sprintf("Log-%d%02d%02d%02d%02d%02d.txt",
+		t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second())
+}
+
+// Returns the name that should be given to the manifest file. Names go down to
+// the second, so that each run gets its own file.
+func manifestFileName() string {
+	t := time.Now()
+	return fmt.Sprintf("Manifest-%d%02d%02d%02d%02d%02d.jsonl",
+		t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second())
+}
+
+// Returns the latest entry of every file recorded in the manifests of
+// previous runs, by absolute path.
+func readManifests(logsDir string) map[string]*manifest.Entry {
+	paths, err := filepath.Glob(filepath.Join(logsDir, "Manifest-*.jsonl"))
+	if err != nil {
+		log.Printf("Error reading manifests: %v", err)
+		return nil
+	}
+	var entries []*manifest.Entry
+	for _, path := range paths {
+		e, err := manifest.Read(path)
+		if err != nil {
+			log.Printf("Error reading manifest: %v", err)
+			continue
+		}
+		entries = append(entries, e...)
+	}
+	return manifest.Latest(entries)
 }
 
+// Checks the given files from the manifests of previous runs. Files that do
+// not match their record are moved to the quarantine dir, so that this run
+// downloads them again and nothing is lost if the record was wrong.
+func verifyManifests(latest map[string]*manifest.Entry, quarantineDir string) {
+	log.Printf("Verifying %d files.", len(latest))
+	bad := 0
+	for path, e := range latest {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			continue // Could have been moved away on purpose.
+		}
+		err := e.Check()
+		if err != nil {
+			bad++
+			to, qerr := scrapers.QuarantineFile(quarantineDir, e.Chain, path,
+				err)
+			if qerr != nil {
+				log.Printf("Verify error: %v, failed to quarantine: %v", err,
+					qerr)
+				continue
+			}
+			log.Printf("Verify error: %v, quarantined to '%s'.", err, to)
+		}
+	}
+	log.Printf("Verified files, %d did not match.", bad)
+}
+
+// Minimal size of a valid downloaded file, when validating.
+const defaultMinSize = 64
+
 // Holds parsed command-line arguments.
 var args struct {
-	Dir       string   // Where to download files.
-	ChainList []string // List of chain names to include in this run, parsed from Chains.
-	Stdout    bool     `flug:"stdout,Log to stdout instead of log file."`
-	From      string   `flug:"from,Download files from this time and on. Format: YYYYMMDDhhmm. (default download all files)"`
-	Chains    string   `flug:"chains,Comma separated chain names to include in this run. (default all)"`
+	Dir          string   // Where to download files.
+	ChainList    []string // List of chain names to include in this run, parsed from Chains.
+	List         bool     `flug:"list,Print the files each chain publishes without downloading them. The out dir can be omitted."`
+	Format       string   `flug:"format,Output format of -list: table or json. (default table)"`
+	Stdout       bool     `flug:"stdout,Log to stdout instead of log file."`
+	Summary      string   `flug:"summary,Where to write the run's JSON summary, or - for stdout. (default in the logs dir)"`
+	Verify       bool     `flug:"verify,Check files recorded in previous runs' manifests, and move ones that do not match to the quarantine dir so that they are downloaded again."`
+	Validate     bool     `flug:"validate,Check that downloaded files are intact XML data, and move ones that are not to the quarantine dir."`
+	MinSize      int64    `flug:"minsize,In validation, minimal size of a downloaded file in bytes. (default 64)"`
+	From         string   `flug:"from,Download files from this time and on. Format: YYYYMMDDhhmm, Israel time. Stores files from before this time are also downloaded, since they may still be in effect. (default download all files)"`
+	To           string   `flug:"to,Download files up to this time, inclusive. Format: YYYYMMDDhhmm, Israel time. (default no limit)"`
+	Dates        string   `flug:"dates,Download files from this range of days, as YYYY-MM-DD..YYYY-MM-DD or a single YYYY-MM-DD. Cannot be used with from or to."`
+	Types        string   `flug:"types,Comma separated file types to download: Price, PriceFull, Promo, PromoFull, Stores. (default all)"`
+	Stores       string   `flug:"stores,Comma separated store IDs whose files to download. Files of no store, like Stores, are always downloaded. (default all)"`
+	Config       string   `flug:"config,JSON file that configures the chains to scrape. (default the built-in chains)"`
+	Chains       string   `flug:"chains,Comma separated chain names to include in this run. (default all)"`
+	Retries      int      `flug:"retries,Number of attempts per file, including the first. (default 4)"`
+	Backoff      string   `flug:"backoff,Wait range between attempts, doubling per attempt, e.g. 1s-1m. (default 1s-1m)"`
+	RetryOn      string   `flug:"retryon,Comma separated failures to retry: 5xx, 429, timeout, reset. (default all)"`
+	Threads      int      `flug:"threads,Number of download threads per chain. (default number of CPUs)"`
+	Parallel     int      `flug:"parallel,Number of chains to scrape at the same time. (default 1)"`
+	HostRate     float64  `flug:"hostrate,Maximal requests per second to each host, -1 for unlimited. (default 5)"`
+	HostConns    int      `flug:"hostconns,Maximal open requests to each host, -1 for unlimited. (default 4)"`
+	HostLimits   string   `flug:"hostlimits,Comma separated host-specific limits, as host=rate/conns, e.g. url.publishedprices.co.il=2/4."`
+	MaxConns     int      `flug:"maxconns,Maximal open requests across all hosts. (default unlimited)"`
+	CAFile       string   `flug:"cafile,PEM file of CA certificates to trust, besides the system's."`
+	Cert         string   `flug:"cert,PEM file of a client certificate to present to sites."`
+	Key          string   `flug:"key,PEM file of the client certificate's key."`
+	Insecure     string   `flug:"insecure,Comma separated hosts whose TLS certificates are not verified. Logs a warning on every request."`
+	Proxy        string   `flug:"proxy,URL of a proxy for all requests, e.g. http://proxy:3128. (default from the HTTP_PROXY and HTTPS_PROXY environment variables)"`
+	IdleConns    int      `flug:"idleconns,Idle connections kept open to each host for following requests. (default 16)"`
+	HTTP1        bool     `flug:"http1,Use only HTTP/1.1, also with sites that support HTTP/2."`
+	Daemon       bool     `flug:"daemon,Keep running and scrape each chain on a schedule, until interrupted."`
+	Every        string   `flug:"every,In daemon mode, how often to scrape each chain, e.g. 1h. (default 1h)"`
+	Schedule     string   `flug:"schedule,In daemon mode, comma separated chain-specific intervals, as chain=interval or chain:Type+Type=interval to download only some file types. A chain may have several entries, e.g. coop=24h,shufersal:Price+Promo=30m,shufersal:PriceFull+PromoFull+Stores=24h."`
+	Timeout      string   `flug:"timeout,Stop the whole run after this duration, e.g. 5h. (default no limit)"`
+	ChainTimeout string   `flug:"chaintimeout,Stop each chain after this duration, e.g. 30m. (default no limit)"`
+	HTTPTimeouts string   `flug:"httptimeouts,Timeouts of each request as connect/header/idle, where idle is the longest wait between reads of the body, e.g. 10s/30s/1m. 0 means no limit. (default 10s/30s/30s)"`
+
+	every        time.Duration               // Parsed from Every.
+	schedule     map[string][]*scheduleEntry // Parsed from Schedule.
+	timeout      time.Duration               // Parsed from Timeout.
+	chainTimeout time.Duration               // Parsed from ChainTimeout.
 }
 
 // Signifies that no args were given.
@@ -140,15 +355,100 @@ func parseArgs() error {
 	flug.Register(&args)
 	flag.Parse()
 
-	// Parse timestamp.
+	if args.MinSize == 0 {
+		args.MinSize = defaultMinSize
+	}
+
+	// Parse timestamps.
+	if args.Dates != "" {
+		if args.From != "" || args.To != "" {
+			return fmt.Errorf("dates cannot be used with from or to")
+		}
+		err := parseDates()
+		if err != nil {
+			return err
+		}
+	}
 	if args.From != "" {
 		err := scrapers.SetFromTimestamp(args.From)
 		if err != nil {
 			return err
 		}
 	}
+	if args.To != "" {
+		err := scrapers.SetToTimestamp(args.To)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Parse file filters.
+	if args.Types != "" {
+		err := scrapers.SetFileTypes(strings.Split(args.Types, ","))
+		if err != nil {
+			return err
+		}
+	}
+	if args.Stores != "" {
+		err := scrapers.SetStores(strings.Split(args.Stores, ","))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Parse retry policy.
+	err := parseRetryPolicy()
+	if err != nil {
+		return err
+	}
+
+	// Parse limits.
+	err = parseLimits()
+	if err != nil {
+		return err
+	}
+
+	// Parse TLS and connection settings.
+	err = parseTLS()
+	if err != nil {
+		return err
+	}
+	err = parsePool()
+	if err != nil {
+		return err
+	}
+
+	// Parse deadlines.
+	if args.Timeout != "" {
+		d, err := time.ParseDuration(args.Timeout)
+		if err != nil {
+			return fmt.Errorf("bad timeout: %v", err)
+		}
+		args.timeout = d
+	}
+	if args.ChainTimeout != "" {
+		d, err := time.ParseDuration(args.ChainTimeout)
+		if err != nil {
+			return fmt.Errorf("bad chain timeout: %v", err)
+		}
+		args.chainTimeout = d
+	}
+	if args.HTTPTimeouts != "" {
+		t, err := scrapers.ParseTimeouts(args.HTTPTimeouts)
+		if err != nil {
+			return err
+		}
+		err = scrapers.SetTimeouts(t)
+		if err != nil {
+			return err
+		}
+	}
 
 	// Parse chains.
+	err = loadChains(args.Config)
+	if err != nil {
+		return err
+	}
 	if args.Chains == "" {
 		for chain := range tasks {
 			args.ChainList = append(args.ChainList, chain)
@@ -164,8 +464,27 @@ func parseArgs() error {
 		}
 	}
 
+	// Parse schedule. Done after chains, to check chain names.
+	err = parseSchedule()
+	if err != nil {
+		return err
+	}
+
+	// Parse list format.
+	switch args.Format {
+	case "":
+		args.Format = formatTable
+	case formatTable, formatJSON:
+	default:
+		return fmt.Errorf("bad format: %q, expected %q or %q", args.Format,
+			formatTable, formatJSON)
+	}
+
 	// No args.
 	if len(flag.Args()) == 0 {
+		if args.List {
+			return nil
+		}
 		return noArgs
 	}
 
@@ -179,11 +498,140 @@ func parseArgs() error {
 	return nil
 }
 
+// Sets the from and to flags according to the dates flag.
+func parseDates() error {
+	dates := strings.Split(args.Dates, "..")
+	if len(dates) > 2 {
+		return fmt.Errorf("bad dates: %q, expected %q", args.Dates,
+			"YYYY-MM-DD..YYYY-MM-DD")
+	}
+	var days []time.Time
+	for _, date := range dates {
+		day, err := time.Parse("2006-01-02", date)
+		if err != nil {
+			return fmt.Errorf("bad dates: %q: %v", args.Dates, err)
+		}
+		days = append(days, day)
+	}
+	args.From = days[0].Format("20060102") + "0000"
+	args.To = days[len(days)-1].Format("20060102") + "2359"
+	return nil
+}
+
+// Sets the scrapers' threads and rate limits according to the limit flags.
+func parseLimits() error {
+	if args.Threads != 0 {
+		err := scrapers.SetThreads(args.Threads)
+		if err != nil {
+			return err
+		}
+	}
+	if args.Parallel == 0 {
+		args.Parallel = 1
+	}
+	if args.Parallel < 0 {
+		return fmt.Errorf("bad number of parallel chains: %d", args.Parallel)
+	}
+
+	limit := scrapers.DefaultHostLimit
+	switch {
+	case args.HostRate < 0:
+		limit.Rate = 0
+	case args.HostRate > 0:
+		limit.Rate = args.HostRate
+		limit.Burst = int(args.HostRate)
+		if limit.Burst < 1 {
+			limit.Burst = 1
+		}
+	}
+	switch {
+	case args.HostConns < 0:
+		limit.MaxInFlight = 0
+	case args.HostConns > 0:
+		limit.MaxInFlight = args.HostConns
+	}
+	err := scrapers.SetDefaultHostLimit(limit)
+	if err != nil {
+		return err
+	}
+	if args.HostLimits != "" {
+		err = scrapers.ParseHostLimits(args.HostLimits)
+		if err != nil {
+			return err
+		}
+	}
+	return scrapers.SetMaxInFlight(args.MaxConns)
+}
+
+// Sets the scrapers' TLS settings according to the TLS flags.
+func parseTLS() error {
+	c := scrapers.TLSConfig{CAFile: args.CAFile, CertFile: args.Cert,
+		KeyFile: args.Key}
+	if args.Insecure != "" {
+		c.InsecureHosts = strings.Split(args.Insecure, ",")
+	}
+	return scrapers.SetTLSConfig(c)
+}
+
+// Sets the scrapers' connection settings according to the connection flags.
+func parsePool() error {
+	p := scrapers.DefaultPoolConfig
+	p.Proxy = args.Proxy
+	p.HTTP2 = !args.HTTP1
+	if args.IdleConns != 0 {
+		p.MaxIdlePerHost = args.IdleConns
+	}
+	return scrapers.SetPoolConfig(p)
+}
+
+// Sets the scrapers' retry policy according to the retry flags.
+func parseRetryPolicy() error {
+	p := scrapers.DefaultRetryPolicy
+	if args.Retries != 0 {
+		p.Attempts = args.Retries
+	}
+	if args.Backoff != "" {
+		parts := strings.Split(args.Backoff, "-")
+		if len(parts) != 2 {
+			return fmt.Errorf("bad backoff: %q, expected %q", args.Backoff,
+				"min-max")
+		}
+		var err error
+		p.MinBackoff, err = time.ParseDuration(parts[0])
+		if err != nil {
+			return fmt.Errorf("bad backoff: %v", err)
+		}
+		p.MaxBackoff, err = time.ParseDuration(parts[1])
+		if err != nil {
+			return fmt.Errorf("bad backoff: %v", err)
+		}
+	}
+	if args.RetryOn != "" {
+		var err error
+		p.Classes, err = scrapers.ParseRetryClass(args.RetryOn)
+		if err != nil {
+			return err
+		}
+	}
+	return scrapers.SetRetryPolicy(p)
+}
+
 // Help message to display when run with no arguments.
 var help = `Downloads price data from stores.
 
 Usage:
 scrape <out dir>
+scrape -list [out dir]
+
+Exit codes:
+0 all chains succeeded
+1 bad arguments, nothing was scraped
+2 some chains failed
+3 all chains failed
+
+In daemon mode, the program runs until interrupted and exits with 0. The
+summary file is rewritten after every run, with the latest run of each chain
+and file types in the schedule.
 
 Flags:`
 
@@ -196,7 +644,7 @@ func logWelcome() {
 	log.Print("We have lift off!")
 
 	// Print grep help.
-	log.Print("To search for a specific chain use grep '^ChainName'.")
+	log.Print("To search for a specific chain use grep ' chainname '.")
 	log.Print("To search for errors, use grep 'error' (use tail to omit this line).")
 	log.Print("To search for times, use grep 'took'.")
 
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fluhus/prices/scrape/manifest"
+)
+
+func TestVerifyManifests(t *testing.T) {
+	dir := t.TempDir()
+	logs := filepath.Join(dir, "logs")
+	data := filepath.Join(dir, "2026-10-17", "a", "Price1.gz")
+	os.MkdirAll(logs, 0700)
+	os.MkdirAll(filepath.Dir(data), 0700)
+	ioutil.WriteFile(data, []byte("hello"), 0600)
+	sum, size, err := manifest.HashFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := manifest.Create(filepath.Join(logs, "Manifest-1.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Add(&manifest.Entry{Chain: "a", Path: data, Size: size, SHA256: sum})
+	w.Close()
+
+	// A matching file stays.
+	quarantine := filepath.Join(dir, "quarantine")
+	verifyManifests(readManifests(logs), quarantine)
+	if _, err := os.Stat(data); err != nil {
+		t.Fatalf("verifyManifests(...) moved a matching file: %v", err)
+	}
+
+	// A changed file is moved to the quarantine, not deleted.
+	ioutil.WriteFile(data, []byte("hellO"), 0600)
+	verifyManifests(readManifests(logs), quarantine)
+	if _, err := os.Stat(data); !os.IsNotExist(err) {
+		t.Errorf("verifyManifests(...) kept a changed file")
+	}
+	got, err := ioutil.ReadFile(filepath.Join(quarantine, "a", "Price1.gz"))
+	if err != nil || string(got) != "hellO" {
+		t.Errorf("verifyManifests(...) quarantined %q,%v want %q", got, err,
+			"hellO")
+	}
+}
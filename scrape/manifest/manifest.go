@@ -0,0 +1,174 @@
+// Package manifest records the files fetched by a scrape run, so that they can
+// be checked later.
+//
+// A manifest is a JSON Lines file with one entry per file. Paths are stored
+// relative to the manifest's directory, so a scrape output directory can be
+// moved as a whole.
+package manifest
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// An Entry describes a single file of a scrape run.
+type Entry struct {
+	Chain        string    `json:"chain"`
+	URL          string    `json:"url"`
+	Path         string    `json:"path"`
+	Size         int64     `json:"size"`
+	SHA256       string    `json:"sha256,omitempty"`
+	ModTime      time.Time `json:"mod_time"`                // Of the file when hashed.
+	Status       int       `json:"status,omitempty"`        // HTTP status, 0 if skipped.
+	LastModified string    `json:"last_modified,omitempty"` // As sent by the server.
+	Duration     float64   `json:"duration_sec"`            // Download time.
+	Skipped      bool      `json:"skipped"`                 // Already present.
+	Error        string    `json:"error,omitempty"`         // Why the download failed.
+	Time         time.Time `json:"time"`                    // When the entry was added.
+}
+
+// A Writer adds entries to a manifest file. Safe for concurrent use.
+type Writer struct {
+	mutex sync.Mutex
+	dir   string // Directory of the manifest, for relative paths.
+	file  *os.File
+	buf   *bufio.Writer
+	enc   *json.Encoder
+}
+
+// Create creates a new manifest file at the given path. Fails if the file
+// exists, so that another run's manifest is never overwritten.
+func Create(path string) (*Writer, error) {
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(f)
+	return &Writer{dir: dir, file: f, buf: buf, enc: json.NewEncoder(buf)}, nil
+}
+
+// Add writes an entry to the manifest. The entry's path is stored relative to
+// the manifest's directory, and its time is set if empty.
+func (w *Writer) Add(e *Entry) error {
+	ee := *e
+	if abs, err := filepath.Abs(ee.Path); err == nil {
+		if rel, err := filepath.Rel(w.dir, abs); err == nil {
+			ee.Path = filepath.ToSlash(rel)
+		}
+	}
+	if ee.Time.IsZero() {
+		ee.Time = time.Now()
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	err := w.enc.Encode(&ee)
+	if err != nil {
+		return err
+	}
+	// Flush every entry, so that an interrupted run still has its manifest.
+	return w.buf.Flush()
+}
+
+// Close flushes and closes the manifest file.
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	err := w.buf.Flush()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Read reads all entries from a manifest file. Entry paths are resolved
+// relative to the manifest's directory, into absolute paths.
+func Read(path string) ([]*Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Entry
+	dec := json.NewDecoder(bufio.NewReader(f))
+	for {
+		e := &Entry{}
+		err := dec.Decode(e)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s entry #%d: %v", path, len(result)+1, err)
+		}
+		e.Path = filepath.FromSlash(e.Path)
+		if !filepath.IsAbs(e.Path) {
+			e.Path = filepath.Join(dir, e.Path)
+		}
+		result = append(result, e)
+	}
+	return result, nil
+}
+
+// Check checks that the entry's file exists with the recorded size and
+// SHA-256. Entries of failed downloads cannot be checked.
+func (e *Entry) Check() error {
+	if e.Error != "" || e.SHA256 == "" {
+		return fmt.Errorf("no checksum for %s", e.Path)
+	}
+	sum, size, err := HashFile(e.Path)
+	if err != nil {
+		return err
+	}
+	if size != e.Size {
+		return fmt.Errorf("size of %s is %d, expected %d", e.Path, size,
+			e.Size)
+	}
+	if sum != e.SHA256 {
+		return fmt.Errorf("checksum mismatch for %s", e.Path)
+	}
+	return nil
+}
+
+// HashFile returns the hex SHA-256 and the size of the given file.
+func HashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// Latest returns the last entry with a checksum for every path in the given
+// entries.
+func Latest(entries []*Entry) map[string]*Entry {
+	result := map[string]*Entry{}
+	for _, e := range entries {
+		if e.SHA256 != "" && e.Error == "" {
+			result[e.Path] = e
+		}
+	}
+	return result
+}
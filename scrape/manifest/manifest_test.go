@@ -0,0 +1,66 @@
+package manifest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteReadCheck(t *testing.T) {
+	dir := t.TempDir()
+	data := filepath.Join(dir, "2026-10-17", "chain", "Price1.gz")
+	if err := writeFile(data, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	sum, size, err := HashFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "logs", "Manifest.jsonl")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	w, err := Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Add(&Entry{Chain: "chain", Path: data, Size: size,
+		SHA256: sum}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(path); err == nil {
+		t.Errorf("Create(%q) over an existing manifest succeeded, want error",
+			path)
+	}
+
+	entries, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != data {
+		t.Fatalf("Read(%q)=%v want 1 entry with path %q", path, entries, data)
+	}
+	if err := entries[0].Check(); err != nil {
+		t.Errorf("Check()=%v want nil", err)
+	}
+
+	if err := writeFile(data, "hellO"); err != nil {
+		t.Fatal(err)
+	}
+	if err := entries[0].Check(); err == nil {
+		t.Errorf("Check() on a changed file succeeded, want error")
+	}
+}
+
+// Writes a file, creating its directory.
+func writeFile(path, data string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, []byte(data), 0600)
+}
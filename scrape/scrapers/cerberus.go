@@ -3,118 +3,121 @@ package scrapers
 // A scraper for Cerberus-based databases.
 
 import (
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"path/filepath"
+	urllib "net/url"
+	"path"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fluhus/prices/filename"
 )
 
 const (
 	// Cerberus login page.
 	cerberusHome = "https://url.publishedprices.co.il/"
 
-	// Cerberus user page (with file list).
-	cerberusUser = cerberusHome + "login/user"
+	// Cerberus user page (with file list), relative to the login page.
+	cerberusUser = "login/user"
 
-	// File server address.
-	cerberusFile = cerberusHome + "file/"
+	// File server address, relative to the login page.
+	cerberusFile = "file/"
 
-	// File download address.
+	// File download address, relative to the login page.
 	cerberusDownload = cerberusFile + "d/"
+
+	// Number of entries to request per listing page.
+	cerberusPageSize = 1000
+
+	// Levels of folders to enter below the root folder.
+	cerberusMaxDepth = 5
 )
 
 // A scraper for Cerberus-based databases.
 type cerberusScraper struct {
+	home     string // Login page, normally cerberusHome.
 	username string
 	password string
+	cl       *http.Client // Logged-in client, kept between runs.
+	pageSize int          // Entries per listing page, 0 for cerberusPageSize.
 }
 
 // Returns a new Cerberus scraper with the given user-name.
 func Cerberus(username, password string) Scraper {
-	return &cerberusScraper{username, password}
+	return &cerberusScraper{home: cerberusHome, username: username,
+		password: password}
 }
 
-func (a *cerberusScraper) Scrape(dir string) error {
-	// Login to Cerberus.
-	cl, err := a.login()
+func (a *cerberusScraper) Scrape(ctx context.Context, dir string) error {
+	cl, files, err := a.list(ctx)
 	if err != nil {
-		return fmt.Errorf("Failed to login: %v", err)
+		return err
 	}
+	return downloadFiles(ctx, dir, files, cl)
+}
 
-	// Download file list.
-	files, err := a.getFileList(cl)
+func (a *cerberusScraper) List(ctx context.Context) ([]*RemoteFile, error) {
+	_, files, err := a.list(ctx)
+	return files, err
+}
+
+// Returns a logged-in client and the data files to download.
+func (a *cerberusScraper) list(ctx context.Context) (*http.Client,
+	[]*RemoteFile, error) {
+	// Login to Cerberus and download file list.
+	cl, files, err := a.session(ctx)
 	if err != nil {
-		return fmt.Errorf("Failed to get file list: %v", err)
+		return nil, nil, err
 	}
 
 	// Filter only data files.
 	files = a.filterFileNames(files)
 	if len(files) == 0 {
-		return fmt.Errorf("Found no files after filtering.")
-	}
-
-	// Download files!
-	fileChan := make(chan string, numberOfThreads)
-	done := make(chan error, numberOfThreads)
-
-	// Start downloader threads.
-	for i := 0; i < numberOfThreads; i++ {
-		go func() {
-			for file := range fileChan {
-				outFile := filepath.Join(dir, file)
-				_, err := downloadIfNotExists(cerberusDownload+file,
-					outFile, cl)
-				if err != nil {
-					done <- fmt.Errorf("Failed to download: %v", err)
-					return
-				}
-			}
-			done <- nil
-		}()
+		return nil, nil, fmt.Errorf("Found no files after filtering.")
 	}
 
-	// Push file names to channel.
-	go func() {
-		for _, file := range files {
-			fileChan <- file
+	return cl, filterFiles(ctx, files), nil
+}
+
+// Returns a logged-in client and the file list. The session of a previous run
+// is reused if it is still valid, otherwise logs in again.
+func (a *cerberusScraper) session(ctx context.Context) (*http.Client,
+	[]*RemoteFile, error) {
+	if a.cl != nil {
+		files, err := a.getFileList(ctx, a.cl)
+		if err == nil {
+			return a.cl, files, nil
 		}
-		close(fileChan)
-	}()
-
-	// Wait for threads to finish.
-	for i := 0; i < numberOfThreads; i++ {
-		e := <-done
-		if e != nil {
-			err = e
+		if ctx.Err() != nil {
+			return nil, nil, fmt.Errorf("Failed to get file list: %v", err)
 		}
+		logf(ctx, "Previous session failed, logging in again: %v", err)
+		a.cl = nil
 	}
-	close(done)
 
-	// Drain file channel.
-	for range fileChan {
+	cl, err := a.login(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to login: %v", err)
 	}
-
-	return err
+	files, err := a.getFileList(ctx, cl)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to get file list: %v", err)
+	}
+	a.cl = cl
+	return cl, files, nil
 }
 
 // Returns a logged-in client.
-func (a *cerberusScraper) login() (*http.Client, error) {
-	// TODO(amit):
-	// THIS IS A TERRIBLE WORKAROUND TO A CERTIFICATE VALIDATION BUG IN THE
-	// HUJI COMPUTER SYSTEM. THIS IS INSECURE AND SHOULD BE FIXED.
-
-	// cl := &http.Client {}
-	cl := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	}
+func (a *cerberusScraper) login(ctx context.Context) (*http.Client, error) {
+	cl := newClient(nil)
 
 	// Get login page.
-	res, err := httpGet(cerberusHome, cl)
+	res, err := httpGet(ctx, a.home, cl)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to get homepage: %v", err)
 	}
@@ -123,6 +126,7 @@ func (a *cerberusScraper) login() (*http.Client, error) {
 		return nil, fmt.Errorf("Got bad response status: %s", res.Status)
 	}
 	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close() // Frees the host's request slot before logging in.
 	if err != nil {
 		return nil, fmt.Errorf("Failed to read homepage: %v", err)
 	}
@@ -130,7 +134,7 @@ func (a *cerberusScraper) login() (*http.Client, error) {
 	// Get token and cookie.
 	token, err := a.parseToken(body)
 	if err != nil {
-		return nil, err
+		return nil, savePage(ctx, res, body, err)
 	}
 	preCookie, err := a.parseCookie(res)
 	if err != nil {
@@ -138,11 +142,11 @@ func (a *cerberusScraper) login() (*http.Client, error) {
 	}
 
 	// Login!
-	jar := singleCookieJar(cerberusHome, "cftpSID", string(preCookie))
+	jar := singleCookieJar(a.home, "cftpSID", string(preCookie))
 	cl.Jar = jar
 
-	res2, err := httpPost(
-		cerberusUser,
+	res2, err := httpPost(ctx,
+		a.home+cerberusUser,
 		map[string][]string{
 			"csrftoken": []string{string(token)},
 			"username":  []string{a.username},
@@ -168,7 +172,7 @@ func (a *cerberusScraper) login() (*http.Client, error) {
 	}
 
 	// Update client with new cookie.
-	cl.Jar = singleCookieJar(cerberusHome, "cftpSID", string(postCookie))
+	cl.Jar = singleCookieJar(a.home, "cftpSID", string(postCookie))
 
 	return cl, nil
 }
@@ -197,48 +201,210 @@ func (a *cerberusScraper) parseToken(body []byte) ([]byte, error) {
 }
 
 // Gets the list of files from Cerberus, using the given logged-in client.
-func (a *cerberusScraper) getFileList(cl *http.Client) ([]string, error) {
+// Folders are listed recursively, up to cerberusMaxDepth levels. Names of files
+// in folders include their folder, as in "branches/Price1.gz".
+func (a *cerberusScraper) getFileList(ctx context.Context, cl *http.Client) (
+	[]*RemoteFile, error) {
+	result := []*RemoteFile{}
+	folders := []string{"/"}
+	for depth := 0; len(folders) > 0; depth++ {
+		var subfolders []string
+		for _, folder := range folders {
+			files, sub, err := a.getFolder(ctx, cl, folder)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, files...)
+			if depth < cerberusMaxDepth {
+				subfolders = append(subfolders, sub...)
+			} else if len(sub) > 0 {
+				logf(ctx, "Not entering %d folders below %s, too deep.",
+					len(sub), folder)
+			}
+		}
+		folders = subfolders
+	}
+
+	// An empty file list should be reported.
+	if len(result) == 0 {
+		return nil, fmt.Errorf("Got an empty file list.")
+	}
+
+	return result, nil
+}
+
+// Returns the files and the subfolders in the given folder, reading all
+// pages of its listing.
+func (a *cerberusScraper) getFolder(ctx context.Context, cl *http.Client,
+	folder string) ([]*RemoteFile, []string, error) {
+	pageSize := a.pageSize
+	if pageSize == 0 {
+		pageSize = cerberusPageSize
+	}
+
+	var files []*RemoteFile
+	var folders []string
+	for start := 0; ; start += pageSize {
+		page, err := a.getPage(ctx, cl, folder, start, pageSize)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		for _, entry := range page.AaData {
+			if entry.Type == "folder" {
+				folders = append(folders, folder+entry.Value+"/")
+				continue
+			}
+			// Files keep their folder, so that same-named files in
+			// different folders do not overwrite each other.
+			name := folder[1:] + path.Base(entry.Value)
+			files = append(files, &RemoteFile{
+				Name: name,
+				URL:  a.home + cerberusDownload + escapePath(name),
+				Size: a.parseSize(entry.Size),
+				Time: a.parseTime(entry.Ftime),
+			})
+		}
+
+		// Servers may report no total, so stop at a short page too.
+		if len(page.AaData) < pageSize ||
+			start+pageSize >= page.ITotalDisplayRecords {
+			break
+		}
+	}
+
+	return files, folders, nil
+}
+
+// Escapes each segment of a slash separated path, so that names with spaces,
+// '#', '?' or non-ASCII letters can be used in URLs.
+func escapePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i := range parts {
+		parts[i] = urllib.PathEscape(parts[i])
+	}
+	return strings.Join(parts, "/")
+}
+
+// A page of a folder listing, as returned by Cerberus.
+type cerberusPage struct {
+	ITotalDisplayRecords int // Entries in the whole folder.
+	AaData               []*struct {
+		Value string
+		Type  string      // "file" or "folder".
+		Size  interface{} // A number or a string.
+		Ftime string
+	}
+}
+
+// Returns the listing of the given folder, from entry start on.
+func (a *cerberusScraper) getPage(ctx context.Context, cl *http.Client,
+	folder string, start, length int) (*cerberusPage, error) {
 	// Request file list.
-	res, err := httpPost(cerberusFile+"ajax_dir?sEcho=2&iColumns=5&sColumns=%2C%2C%2C%2C&iDisplayStart=0&iDisplayLength=100000&mDataProp_0=fname&sSearch_0=&bRegex_0=false&bSearchable_0=true&bSortable_0=true&mDataProp_1=type&sSearch_1=&bRegex_1=false&bSearchable_1=true&bSortable_1=false&mDataProp_2=size&sSearch_2=&bRegex_2=false&bSearchable_2=true&bSortable_2=true&mDataProp_3=ftime&sSearch_3=&bRegex_3=false&bSearchable_3=true&bSortable_3=true&mDataProp_4=&sSearch_4=&bRegex_4=false&bSearchable_4=true&bSortable_4=false&sSearch=&bRegex=false&iSortingCols=0&cd=%2F", nil, cl)
+	query := a.listQuery(folder, start, length)
+	res, err := httpPost(ctx, a.home+cerberusFile+"ajax_dir?"+query.Encode(),
+		nil, cl)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to post request: %v", err)
 	}
+	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("Got bad response status: %s", res.Status)
 	}
 
 	// Parse file list.
-	var resData struct { // Represents the json response structure.
-		AaData []*struct {
-			Value string
-		}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read response: %v", err)
 	}
-	err = json.NewDecoder(res.Body).Decode(&resData)
+	if a.isLoginPage(res, body) {
+		return nil, fmt.Errorf("Got the login page, session expired.")
+	}
+	result := &cerberusPage{}
+	err = json.Unmarshal(body, result)
 	if err != nil {
-		return nil, fmt.Errorf("Failed to parse response: %v", err)
+		return nil, savePage(ctx, res, body,
+			fmt.Errorf("Failed to parse response: %v", err))
 	}
-	res.Body.Close()
 
-	// An empty file list should be reported.
-	if len(resData.AaData) == 0 {
-		return nil, fmt.Errorf("Got an empty file list.")
+	return result, nil
+}
+
+// Returns true if the response is the login page, which Cerberus sends
+// instead of a listing when the session has expired. Such a page is not a
+// parsing failure, so it should not be saved.
+func (a *cerberusScraper) isLoginPage(res *http.Response, body []byte) bool {
+	if res.Request != nil && !strings.HasSuffix(res.Request.URL.Path,
+		"/ajax_dir") {
+		return true // Redirected.
 	}
+	_, err := a.parseToken(body)
+	return err == nil
+}
 
-	files := make([]string, len(resData.AaData))
-	for i := range files {
-		files[i] = resData.AaData[i].Value
+// Returns the query of a folder listing request. The listing is a DataTables
+// table, whose columns are described in the query.
+func (a *cerberusScraper) listQuery(folder string, start,
+	length int) urllib.Values {
+	result := urllib.Values{}
+	columns := []struct {
+		name     string
+		sortable bool
+	}{{"fname", true}, {"type", false}, {"size", true}, {"ftime", true},
+		{"", false}}
+	for i, col := range columns {
+		n := strconv.Itoa(i)
+		result.Set("mDataProp_"+n, col.name)
+		result.Set("sSearch_"+n, "")
+		result.Set("bRegex_"+n, "false")
+		result.Set("bSearchable_"+n, "true")
+		result.Set("bSortable_"+n, strconv.FormatBool(col.sortable))
 	}
+	result.Set("sEcho", "2")
+	result.Set("iColumns", strconv.Itoa(len(columns)))
+	result.Set("sColumns", strings.Repeat(",", len(columns)-1))
+	result.Set("iDisplayStart", strconv.Itoa(start))
+	result.Set("iDisplayLength", strconv.Itoa(length))
+	result.Set("sSearch", "")
+	result.Set("bRegex", "false")
+	result.Set("iSortingCols", "0")
+	result.Set("cd", folder)
+	return result
+}
 
-	return files, nil
+// Parses the size field of a file list entry. Returns 0 if unknown.
+func (a *cerberusScraper) parseSize(size interface{}) int64 {
+	switch size := size.(type) {
+	case float64:
+		return int64(size)
+	case string:
+		n, _ := strconv.ParseInt(size, 10, 64)
+		return n
+	default:
+		return 0
+	}
+}
+
+// Parses the modification time field of a file list entry, which is in the
+// local time of the site. Returns a zero time if unknown.
+func (a *cerberusScraper) parseTime(ftime string) time.Time {
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04",
+		time.RFC3339} {
+		t, err := time.ParseInLocation(layout, ftime, filename.Location())
+		if err == nil {
+			return t
+		}
+	}
+	return time.Time{}
 }
 
-// Returns a slice with only the file names that are relevant for downloading.
-func (a *cerberusScraper) filterFileNames(files []string) []string {
+// Returns a slice with only the files that are relevant for downloading.
+func (a *cerberusScraper) filterFileNames(files []*RemoteFile) []*RemoteFile {
 	acceptedPattern := regexp.MustCompile("^((Price|Promo).*gz|Stores.*xml)$")
-	result := []string{}
+	result := []*RemoteFile{}
 
 	for _, file := range files {
-		if acceptedPattern.MatchString(file) {
+		if acceptedPattern.MatchString(path.Base(file.Name)) {
 			result = append(result, file)
 		}
 	}
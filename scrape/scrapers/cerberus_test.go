@@ -0,0 +1,309 @@
+package scrapers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	urllib "net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fluhus/prices/filename"
+)
+
+// Returns a fake Cerberus site. Requests after login must carry the
+// session cookie, otherwise they are redirected to the login page.
+func newFakeCerberus(t *testing.T) *fakeSite {
+	s := newFakeSite(t)
+	loggedIn := func(w http.ResponseWriter, r *http.Request) bool {
+		if c, err := r.Cookie("cftpSID"); err != nil || c.Value != "logged-in" {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return false
+		}
+		return true
+	}
+	s.handle("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Add("Set-Cookie", "cftpSID=before-login; path=/")
+		s.writePage(w, "cerberus/home.html")
+	})
+	s.handle("/login/user", func(w http.ResponseWriter, r *http.Request) {
+		c, err := r.Cookie("cftpSID")
+		if r.Method != "POST" || err != nil || c.Value != "before-login" ||
+			r.FormValue("csrftoken") != "fake-csrf-token" ||
+			r.FormValue("username") != "TivTaam" {
+			http.Error(w, "Bad login", http.StatusForbidden)
+			return
+		}
+		w.Header().Add("Set-Cookie", "cftpSID=logged-in; path=/")
+		w.Write([]byte("<html>Welcome</html>"))
+	})
+	s.handle("/file/ajax_dir", func(w http.ResponseWriter, r *http.Request) {
+		if !loggedIn(w, r) {
+			return
+		}
+		if r.FormValue("mDataProp_0") != "fname" {
+			http.Error(w, "Bad query", http.StatusBadRequest)
+			return
+		}
+		// Folder /a/b/ is listed in ajax_dir_a_b.json.
+		file := "cerberus/ajax_dir" + strings.Replace(
+			strings.TrimSuffix(r.FormValue("cd"), "/"), "/", "_", -1) + ".json"
+		writeCerberusPage(w, r, file)
+	})
+	s.handle("/file/d/", func(w http.ResponseWriter, r *http.Request) {
+		if loggedIn(w, r) {
+			w.Write([]byte(fakeData(path.Base(r.URL.Path))))
+		}
+	})
+	return s
+}
+
+// Writes the page of the recorded listing that the request asks for.
+func writeCerberusPage(w http.ResponseWriter, r *http.Request, file string) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	var listing struct {
+		AaData []json.RawMessage `json:"aaData"`
+	}
+	if err := json.Unmarshal(data, &listing); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	start, _ := strconv.Atoi(r.FormValue("iDisplayStart"))
+	length, _ := strconv.Atoi(r.FormValue("iDisplayLength"))
+	total := len(listing.AaData)
+	end := start + length
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"sEcho":                2,
+		"iTotalRecords":        total,
+		"iTotalDisplayRecords": total,
+		"aaData":               listing.AaData[start:end],
+	})
+}
+
+func TestCerberus(t *testing.T) {
+	s := newFakeCerberus(t)
+	checkScrape(t, &cerberusScraper{home: s.home(), username: "TivTaam"},
+		"Price7290873255550-001-202610170300.gz",
+		"branches/Price7290873255550-002-202610170300.gz",
+		"branches/PromoFull7290873255550-002-202610170300.gz",
+		"PriceFull7290873255550-001-202610170300.gz",
+		"PromoFull7290873255550-001-202610170300.gz",
+		"PromoFull7290873255550-002.gz",
+		"Stores7290873255550-202610170100.xml",
+	)
+}
+
+func TestCerberusMetadata(t *testing.T) {
+	defer func(ts int64) { fromTimestamp = ts }(fromTimestamp)
+	if err := SetFromTimestamp("202610170000"); err != nil {
+		t.Fatal(err)
+	}
+	s := newFakeCerberus(t)
+	a := &cerberusScraper{home: s.home(), username: "TivTaam"}
+
+	// One file has the listed size and one does not.
+	dir := t.TempDir()
+	same := filepath.Join(dir, "Price7290873255550-001-202610170300.gz")
+	other := filepath.Join(dir, "PriceFull7290873255550-001-202610170300.gz")
+	ioutil.WriteFile(same, bytes.Repeat([]byte("x"), 10482), 0600)
+	ioutil.WriteFile(other, []byte("old"), 0600)
+
+	if err := a.Scrape(context.Background(), dir); err != nil {
+		t.Fatalf("Scrape(...) failed: %v", err)
+	}
+	if data, _ := ioutil.ReadFile(same); len(data) != 10482 {
+		t.Errorf("Scrape(...) downloaded %s again, want skipped", same)
+	}
+	if data, _ := ioutil.ReadFile(other); string(data) !=
+		fakeData(filepath.Base(other)) {
+		t.Errorf("Scrape(...) saved %q in %s, want downloaded again", data,
+			other)
+	}
+
+	// A file with no timestamp in its name is filtered by its listed time.
+	if fileExists(filepath.Join(dir, "PromoFull7290873255550-002.gz")) {
+		t.Errorf("Scrape(...) downloaded a file listed before the from time")
+	}
+}
+
+func TestCerberusListing(t *testing.T) {
+	s := newFakeCerberus(t)
+	a := &cerberusScraper{home: s.home(), username: "TivTaam"}
+	files, err := a.List(context.Background())
+	if err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+	want := &RemoteFile{
+		Name: "PriceFull7290873255550-001-202610170300.gz",
+		URL:  s.home() + "file/d/PriceFull7290873255550-001-202610170300.gz",
+		Size: 583020,
+		Time: time.Date(2026, 10, 17, 3, 1, 12, 0, filename.Israel),
+	}
+	for _, file := range files {
+		if file.Name != want.Name {
+			continue
+		}
+		if *file != *want {
+			t.Errorf("List() returned %+v, want %+v", file, want)
+		}
+		return
+	}
+	t.Errorf("List() did not return %s", want.Name)
+}
+
+func TestCerberusPages(t *testing.T) {
+	s := newFakeCerberus(t)
+	a := &cerberusScraper{home: s.home(), username: "TivTaam", pageSize: 3}
+	files, err := a.List(context.Background())
+	if err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+	if len(files) != 7 {
+		t.Errorf("List() returned %d files, want 7", len(files))
+	}
+	for _, file := range files {
+		if strings.HasPrefix(file.Name, "branches/") &&
+			file.URL != s.home()+"file/d/"+file.Name {
+			t.Errorf("List() returned URL %s for %s in a folder", file.URL,
+				file.Name)
+		}
+	}
+}
+
+func TestCerberusSameNames(t *testing.T) {
+	const file = "Price7290873255550-001-202610170300.gz"
+	s := newFakeSite(t)
+	s.handle("/file/ajax_dir", func(w http.ResponseWriter, r *http.Request) {
+		entries := []map[string]interface{}{}
+		if r.FormValue("cd") == "/" {
+			for _, folder := range []string{"a", "b"} {
+				entries = append(entries, map[string]interface{}{
+					"value": folder, "type": "folder"})
+			}
+		} else {
+			entries = append(entries, map[string]interface{}{
+				"value": file, "type": "file",
+				"ftime": "2026-10-17 03:00:41"})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"iTotalDisplayRecords": len(entries), "aaData": entries})
+	})
+	s.handle("/file/d/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(fakeData(r.URL.Path)))
+	})
+	a := &cerberusScraper{home: s.home()}
+	files, err := a.getFileList(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("getFileList(...) failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	if err := downloadFiles(context.Background(), dir, files, nil); err != nil {
+		t.Fatalf("downloadFiles(...) failed: %v", err)
+	}
+	for _, folder := range []string{"a", "b"} {
+		got, _ := ioutil.ReadFile(filepath.Join(dir, folder, file))
+		if want := fakeData("/file/d/" + folder + "/" + file); string(got) !=
+			want {
+			t.Errorf("Saved %q in %s/%s, want %q", got, folder, file, want)
+		}
+	}
+}
+
+func TestCerberusEscaping(t *testing.T) {
+	const folder, file = "סניף 1#", "Price7290873255550-001-202610170300 ?.gz"
+	s := newFakeSite(t)
+	s.handle("/file/ajax_dir", func(w http.ResponseWriter, r *http.Request) {
+		entries := []map[string]interface{}{}
+		switch r.FormValue("cd") {
+		case "/":
+			entries = append(entries, map[string]interface{}{
+				"value": folder, "type": "folder"})
+		case "/" + folder + "/":
+			entries = append(entries, map[string]interface{}{
+				"value": file, "type": "file", "size": 10,
+				"ftime": "2026-10-17 03:00:41"})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"iTotalDisplayRecords": len(entries), "aaData": entries})
+	})
+	a := &cerberusScraper{home: s.home()}
+
+	_, folders, err := a.getFolder(context.Background(), nil, "/")
+	if err != nil {
+		t.Fatalf("getFolder(/) failed: %v", err)
+	}
+	if len(folders) != 1 || folders[0] != "/"+folder+"/" {
+		t.Fatalf("getFolder(/) returned folders %q, want [%q]", folders,
+			"/"+folder+"/")
+	}
+	files, _, err := a.getFolder(context.Background(), nil, folders[0])
+	if err != nil {
+		t.Fatalf("getFolder(%q) failed: %v", folders[0], err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("getFolder(%q) returned %d files, want 1", folders[0],
+			len(files))
+	}
+	u, err := urllib.Parse(files[0].URL)
+	if err != nil {
+		t.Fatalf("getFolder(%q) returned a bad URL: %v", folders[0], err)
+	}
+	if want := "/file/d/" + folder + "/" + file; u.Path != want ||
+		u.RawQuery != "" || u.Fragment != "" {
+		t.Errorf("getFolder(%q) returned URL %s, want path %q", folders[0],
+			files[0].URL, want)
+	}
+}
+
+func TestCerberusExpiredSession(t *testing.T) {
+	defer SetFailuresDir("")
+	failures := t.TempDir()
+	SetFailuresDir(failures)
+	s := newFakeCerberus(t)
+	a := &cerberusScraper{home: s.home(), username: "TivTaam"}
+	if _, err := a.List(context.Background()); err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+
+	a.cl.Jar = singleCookieJar(s.home(), "cftpSID", "expired")
+	if _, err := a.getPage(context.Background(), a.cl, "/", 0,
+		cerberusPageSize); err == nil {
+		t.Errorf("getPage(...) with an expired session succeeded, " +
+			"want error")
+	}
+	if _, err := a.List(context.Background()); err != nil {
+		t.Fatalf("List() with an expired session failed: %v", err)
+	}
+	if saved, _ := ioutil.ReadDir(failures); len(saved) != 0 {
+		t.Errorf("List() saved the login page as a failure")
+	}
+}
+
+func TestCerberusBadLogin(t *testing.T) {
+	s := newFakeCerberus(t)
+	a := &cerberusScraper{home: s.home(), username: "Someone"}
+	if _, err := a.List(context.Background()); err == nil {
+		t.Errorf("List() with a bad user succeeded, want error")
+	}
+}
@@ -0,0 +1,88 @@
+package scrapers
+
+// Not a scraper. Lists chains on the authority's page, to alert when chains
+// are added, removed or moved.
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Page with table of chains.
+	chainsPage = "http://economy.gov.il/Trade/ConsumerProtection/Pages/PriceTransparencyRegulations.aspx"
+)
+
+// A ChainInfo is a row in the chain table on the authority's page.
+type ChainInfo struct {
+	Name string `json:"name"` // As written on the page.
+	ID   string `json:"id"`   // GS1 code of the chain, empty if not found.
+	URL  string `json:"url"`  // Where the chain publishes, empty if not found.
+}
+
+// ListChains returns the rows of the chain table on the authority's page.
+func ListChains(ctx context.Context) ([]*ChainInfo, error) {
+	return listChains(ctx, chainsPage)
+}
+
+// Returns the rows of the chain table on the given page.
+func listChains(ctx context.Context, page string) ([]*ChainInfo, error) {
+	logf(ctx, "Checking MOE site for chains.")
+
+	// Get page.
+	res, err := httpGet(ctx, page, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Got status: %s", res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read body: %v", err)
+	}
+
+	// Parse page.
+	rows := regexp.MustCompile("(?s)<tr class=\"ms-rteTable(?:Even|Odd|"+
+		"Footer)Row-mytable\">(.*?)</tr>").FindAllSubmatch(body, -1)
+
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("Found 0 chains; page structure may have changed.")
+	}
+
+	result := make([]*ChainInfo, len(rows))
+	for i, row := range rows {
+		result[i] = parseChainRow(row[1])
+	}
+
+	return result, nil
+}
+
+// Returns the chain in the given table row. The name is in the first cell,
+// and the ID and URL are looked for anywhere in the row.
+func parseChainRow(row []byte) *ChainInfo {
+	result := &ChainInfo{}
+	cells := regexp.MustCompile("(?s)<td[^>]*>(.*?)</td>").
+		FindAllSubmatch(row, -1)
+	if len(cells) > 0 {
+		result.Name = cellText(cells[0][1])
+	}
+	result.ID = string(find([]byte(cellText(row)),
+		"(?:\\D|^)(7\\d{12})(?:\\D|$)"))
+	result.URL = html.UnescapeString(string(find(row,
+		"href=\"(https?://[^\"]*)\"")))
+	return result
+}
+
+// Returns the text of the given HTML, without tags and extra white space.
+func cellText(cell []byte) string {
+	text := regexp.MustCompile("<[^>]*>").ReplaceAll(cell, []byte(" "))
+	return strings.Join(strings.Fields(html.UnescapeString(string(text))), " ")
+}
@@ -0,0 +1,32 @@
+package scrapers
+
+import (
+	"context"
+	"testing"
+)
+
+func TestListChains(t *testing.T) {
+	s := newFakeSite(t)
+	s.page("/chains", "chains/page.html")
+	got, err := listChains(context.Background(), s.home()+"chains")
+	if err != nil {
+		t.Fatalf("listChains(...) failed: %v", err)
+	}
+	want := []ChainInfo{
+		{"שופרסל", "7290027600007", "http://prices.shufersal.co.il/"},
+		{"טיב טעם", "7290873255550",
+			"https://url.publishedprices.co.il/login?user=TivTaam&lang=he"},
+		{"ויקטורי", "7290696200003", "http://www.victory.co.il/prices"},
+		{"רשת חדשה בע\"מ", "7290000000017", "http://prices.newchain.co.il/"},
+		{"רשת בהקמה", "", ""},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("listChains(...) got %d chains, want %d", len(got),
+			len(want))
+	}
+	for i := range want {
+		if *got[i] != want[i] {
+			t.Errorf("listChains(...)[%d]=%+v want %+v", i, got[i], want[i])
+		}
+	}
+}
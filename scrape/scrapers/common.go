@@ -5,31 +5,32 @@ package scrapers
 // Common utilities for all scrapers.
 
 import (
-	"bufio"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/cookiejar"
 	urllib "net/url"
 	"os"
-	"path/filepath"
+	"path"
 	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/fluhus/prices/filename"
 )
 
 const (
 	// User agent to use when scraping.
 	userAgent = "AmitLavonBot/1.0 (doctor_troll@walla.co.il) " +
 		"Price Transparency Project (github.com/fluhus/prices)"
-
-	// HTTP timeout to keep requests from taking forever.
-	httpTimeout = 10 * time.Second
 )
 
 // ----- SCRAPER TYPE ---------------------------------------------------------
@@ -38,20 +39,267 @@ const (
 type Scraper interface {
 	// Downloads all available data files into the specified directory. An
 	// scraper may decide to omit downloading already existing files. An
-	// scraper may use several threads for its work.
-	Scrape(dir string) error
+	// scraper may use several threads for its work. When ctx is canceled or
+	// its deadline passes, all threads stop and the context's error is
+	// returned.
+	Scrape(ctx context.Context, dir string) error
+
+	// Returns the data files that Scrape would download, without downloading
+	// them.
+	List(ctx context.Context) ([]*RemoteFile, error)
+}
+
+// A RemoteFile is a data file that is published by a chain.
+type RemoteFile struct {
+	Name string    `json:"name"`           // Slash separated path to save to.
+	URL  string    `json:"url"`            // Where to download from.
+	Size int64     `json:"size,omitempty"` // In bytes, 0 if unknown.
+	Time time.Time `json:"time"`           // Modification time, zero if unknown.
+}
+
+// Returns the timestamp of the file, inferred from its name, or its listed
+// time if its name has none. Returns -1 if neither is known.
+func (f *RemoteFile) timestamp() int64 {
+	if ts := filename.Timestamp(f.Name); ts != -1 {
+		return ts
+	}
+	if f.Time.IsZero() {
+		return -1
+	}
+	return f.Time.Unix()
+}
+
+// Returns the listed size and time of the file, for logging.
+func (f *RemoteFile) describe() string {
+	size, t := "unknown size", "unknown time"
+	if f.Size > 0 {
+		size = fmt.Sprintf("size %d", f.Size)
+	}
+	if !f.Time.IsZero() {
+		t = "time " + f.Time.Format("2006-01-02 15:04:05")
+	}
+	return size + " and " + t
+}
+
+// ----- HTTP CLIENTS ---------------------------------------------------------
+
+// TLSConfig holds the settings of TLS connections to all sites.
+type TLSConfig struct {
+	CAFile        string   // PEM bundle of CAs to trust, besides the system's.
+	CertFile      string   // PEM client certificate, or empty for none.
+	KeyFile       string   // PEM key of the client certificate.
+	InsecureHosts []string // Hosts whose certificates are not verified.
+}
+
+// A PoolConfig tunes the connections that all scrapers share. Connections are
+// kept alive after requests, so that following requests to the same host reuse
+// them instead of connecting and shaking hands again.
+type PoolConfig struct {
+	MaxIdlePerHost int           // Idle connections kept per host, 0 for 2.
+	IdleTimeout    time.Duration // Before closing idle ones, 0 for no limit.
+	HTTP2          bool          // Use HTTP/2 with sites that support it.
+	Proxy          string        // Proxy URL, or empty for the environment's.
+}
+
+// DefaultPoolConfig keeps enough idle connections for the default host limits
+// and a few chains on the same host.
+var DefaultPoolConfig = PoolConfig{MaxIdlePerHost: 16,
+	IdleTimeout: 90 * time.Second, HTTP2: true}
+
+var (
+	tlsConfig     *tls.Config         // Nil for the default.
+	poolConfig    = DefaultPoolConfig // Of the transport.
+	insecureHosts = map[string]bool{} // Hosts that are not verified.
+
+	// Used by all clients.
+	transport = newTransport(nil, nil, DefaultPoolConfig)
+)
+
+// SetTLSConfig sets the TLS settings of all scrapers. Should be called before
+// scraping starts.
+func SetTLSConfig(c TLSConfig) error {
+	cfg, err := c.build()
+	if err != nil {
+		return err
+	}
+	insecure := map[string]bool{}
+	for _, host := range c.InsecureHosts {
+		insecure[host] = true
+	}
+	transport = newTransport(cfg, insecure, poolConfig)
+	tlsConfig, insecureHosts = cfg, insecure
+	return nil
+}
+
+// SetPoolConfig sets the connection settings of all scrapers. Should be called
+// before scraping starts.
+func SetPoolConfig(c PoolConfig) error {
+	if c.MaxIdlePerHost < 0 || c.IdleTimeout < 0 {
+		return fmt.Errorf("bad pool config: %+v, values must be "+
+			"non-negative", c)
+	}
+	if c.Proxy != "" {
+		u, err := urllib.Parse(c.Proxy)
+		if err != nil {
+			return fmt.Errorf("bad proxy: %v", err)
+		}
+		if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("bad proxy: %q, expected a URL like %q", c.Proxy,
+				"http://host:port")
+		}
+	}
+	transport = newTransport(tlsConfig, insecureHosts, c)
+	poolConfig = c
+	return nil
+}
+
+// Returns the TLS config that applies the CA and certificate settings.
+func (c TLSConfig) build() (*tls.Config, error) {
+	cfg := &tls.Config{}
+
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("found no certificates in %s", c.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// newTransport returns a transport that uses the given TLS config, or the
+// default one if nil, skips verification for the given hosts, and keeps
+// connections according to the pool config. All transports should be made
+// here.
+func newTransport(cfg *tls.Config, insecure map[string]bool,
+	p PoolConfig) http.RoundTripper {
+	secure := newPooledTransport(cfg, p)
+	if len(insecure) == 0 {
+		return secure
+	}
+
+	skip := &tls.Config{}
+	if cfg != nil {
+		skip = cfg.Clone()
+	}
+	skip.InsecureSkipVerify = true
+	return &hostTransport{secure, newPooledTransport(skip, p), insecure}
+}
+
+// Returns a transport with the given TLS config and pool settings. Proxy
+// settings are taken from the environment unless the pool config has one.
+func newPooledTransport(cfg *tls.Config, p PoolConfig) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = cfg
+	t.MaxIdleConns = 0 // Limited per host.
+	t.MaxIdleConnsPerHost = p.MaxIdlePerHost
+	t.IdleConnTimeout = p.IdleTimeout
+	t.ForceAttemptHTTP2 = p.HTTP2
+	if !p.HTTP2 {
+		// A non-nil empty map turns HTTP/2 off.
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	if p.Proxy != "" {
+		if u, err := urllib.Parse(p.Proxy); err == nil {
+			t.Proxy = http.ProxyURL(u)
+		}
+	}
+	return t
+}
+
+// hostTransport sends requests to some hosts through a separate transport.
+type hostTransport struct {
+	def   http.RoundTripper // For all other hosts.
+	other http.RoundTripper // For hosts in the set.
+	hosts map[string]bool
+}
+
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.hosts[req.URL.Hostname()] {
+		return t.other.RoundTrip(req)
+	}
+	return t.def.RoundTrip(req)
+}
+
+// newClient returns a client that uses the scrapers' shared transport, with the
+// given cookie jar. Sessions keep their cookies in the jar, and share the
+// connections with all other clients. Jar may be nil.
+func newClient(jar http.CookieJar) *http.Client {
+	return &http.Client{Transport: transport, Jar: jar}
 }
 
 // ----- COMMON UTILITIES ------------------------------------------------------
 
+// chainKey is the context key for the name of the chain being scraped.
+type chainKey struct{}
+
+// WithChain returns a context that marks work done under it as belonging to
+// the given chain. Log lines of scrapers running under it are prefixed with
+// the chain's name, so several chains can be scraped at once.
+func WithChain(ctx context.Context, chain string) context.Context {
+	return context.WithValue(ctx, chainKey{}, chain)
+}
+
+// Returns the name of the chain given to WithChain, or an empty string.
+func chainOf(ctx context.Context) string {
+	chain, _ := ctx.Value(chainKey{}).(string)
+	return chain
+}
+
+// logf logs a message, prefixed by the name of the chain in ctx.
+func logf(ctx context.Context, format string, a ...interface{}) {
+	msg := fmt.Sprintf(format, a...)
+	if chain := chainOf(ctx); chain != "" {
+		msg = chain + " " + msg
+	}
+	log.Print(msg)
+}
+
 // Maximal number of threads to execute on.
 var numberOfThreads = runtime.NumCPU()
 
+// threadsKey is the context key for the number of threads of a chain.
+type threadsKey struct{}
+
+// WithThreads returns a context that makes scrapers running under it use n
+// threads instead of the number given to SetThreads.
+func WithThreads(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, threadsKey{}, n)
+}
+
+// Returns the number of threads to execute on under ctx.
+func threadsOf(ctx context.Context) int {
+	if n, ok := ctx.Value(threadsKey{}).(int); ok && n > 0 {
+		return n
+	}
+	return numberOfThreads
+}
+
 // Looks up a regular expression in the given sequence and returns the #1
 // captured group. If not found, returns nil - which is different from a 0-long
 // array.
 func find(text []byte, exp string) []byte {
-	return regexp.MustCompile(exp).FindSubmatch(text)[1]
+	match := regexp.MustCompile(exp).FindSubmatch(text)
+	if match == nil {
+		return nil
+	}
+	return match[1]
 }
 
 // Returns a cookie-jar with a single cookie. Error shouldn't happen unless
@@ -105,153 +353,102 @@ func responseSize(res *http.Response) int64 {
 
 // httpGet sends a GET request, with program-specific settings. If client is null,
 // uses the default client.
-func httpGet(url string, c *http.Client) (*http.Response, error) {
+func httpGet(ctx context.Context, url string, c *http.Client) (*http.Response,
+	error) {
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
-	req = req.WithContext(makeContext())
-	if c == nil {
-		c = http.DefaultClient
+	return httpDo(ctx, req, c)
+}
+
+// httpHead sends a HEAD request, with program-specific settings. If client is
+// null, uses the default client.
+func httpHead(ctx context.Context, url string, c *http.Client) (*http.Response,
+	error) {
+	req, err := http.NewRequest("HEAD", url, nil)
+	if err != nil {
+		return nil, err
 	}
-	req.Header.Set("User-Agent", userAgent)
-	return c.Do(req)
+	return httpDo(ctx, req, c)
 }
 
 // httpPost sends a POST request, with program-specific settings. If client is null,
 // uses the default client.
-func httpPost(url string, values urllib.Values, c *http.Client) (*http.Response, error) {
+func httpPost(ctx context.Context, url string, values urllib.Values,
+	c *http.Client) (*http.Response, error) {
+	req, err := newPostRequest(url, values)
+	if err != nil {
+		return nil, err
+	}
+	return httpDo(ctx, req, c)
+}
+
+// newPostRequest creates a POST request with the given form values.
+func newPostRequest(url string, values urllib.Values) (*http.Request, error) {
 	req, err := http.NewRequest("POST", url, strings.NewReader(values.Encode()))
 	if err != nil {
 		return nil, err
 	}
-	req = req.WithContext(makeContext())
 	if values != nil && len(values) > 0 {
 		// Allowing to send POST data by URL, if no values.
 		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	}
-	req.Header.Set("User-Agent", userAgent)
-	if c == nil {
-		c = http.DefaultClient
-	}
-	return c.Do(req)
+	return req, nil
 }
 
-// Downloads a file iff the 'to' path does not exist. Give a client for
-// logged-in sessions, or nil to start a new session. Returns true iff file was
-// downloaded.
-func downloadIfNotExists(url, to string, cl *http.Client) (bool, error) {
-	to = expandPath(to)
-	if !shouldDownloadFile(to) {
-		return false, nil
-	}
-
-	// Create output directory.
-	err := mkdir(filepath.Dir(to))
+// httpDo sends a request with program-specific settings, under the timeouts
+// of ctx and the rate limits of the request's host. The timeouts and the
+// limits are released when the response body is closed, so callers must
+// always close it. If client is null, uses the default client.
+func httpDo(ctx context.Context, req *http.Request, c *http.Client) (
+	*http.Response, error) {
+	release, err := acquire(ctx, req.URL.Host)
 	if err != nil {
-		return false, fmt.Errorf("Failed to make dir: %v", err)
-	}
-
-	// Instantiate client.
-	if cl == nil {
-		cl = &http.Client{}
+		return nil, err
 	}
-
-	// Check if file already exists.
-	if fileExists(to) && fileSize(to) != 0 {
-		return false, nil
+	timeouts := timeoutsOf(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	w, ctx := newWatchdog(ctx, timeouts, cancel)
+	done := func() {
+		w.stop()
+		cancel()
+		release()
 	}
 
-	// Request file.
-	res, err := httpGet(url, cl)
-	if err != nil {
-		return false, fmt.Errorf("Failed to request file: %v", err)
+	req = req.WithContext(ctx)
+	req.Header.Set("User-Agent", userAgent)
+	if c == nil {
+		c = newClient(nil)
 	}
-	defer res.Body.Close()
-	if res.StatusCode != http.StatusOK {
-		return false, fmt.Errorf("Got bad response status: %s", res.Status)
+	if req.URL.Scheme == "https" && insecureHosts[req.URL.Hostname()] {
+		logf(ctx, "Warning: Not verifying the certificate of %s.",
+			req.URL.Hostname())
 	}
-
-	log.Printf("Downloading '%s' to '%s'.", url, to)
-
-	// Open output file.
-	out, err := os.Create(to)
+	res, err := c.Do(req)
 	if err != nil {
-		return false, fmt.Errorf("Failed to create output file: %v", err)
-	}
-	defer out.Close()
-	buf := bufio.NewWriter(out)
-	defer buf.Flush()
-
-	// Download!
-	_, err = io.Copy(buf, res.Body)
-	if err != nil {
-		return false, fmt.Errorf("Failed to save file: %v", err)
+		err = w.err(err)
+		done()
+		return nil, err
 	}
-
-	return true, nil
+	w.start("reading response", timeouts.Idle)
+	res.Body = &doneOnClose{&idleBody{res.Body, w, timeouts.Idle}, done,
+		sync.Once{}}
+	return res, nil
 }
 
-// Downloads a file iff the 'to' path does not exist. Give a client for
-// logged-in sessions, or nil to start a new session. Values will be used as
-// POST form values. Returns true iff file was downloaded.
-func downloadIfNotExistsPost(url, to string, cl *http.Client,
-	values urllib.Values) (bool, error) {
-	to = expandPath(to)
-	if !shouldDownloadFile(to) {
-		return false, nil
-	}
-
-	// Create output directory.
-	err := mkdir(filepath.Dir(to))
-	if err != nil {
-		return false, fmt.Errorf("Failed to make dir: %v", err)
-	}
-
-	// Instantiate client.
-	if cl == nil {
-		cl = &http.Client{}
-	}
-
-	// Check if file already exists.
-	if fileExists(to) && fileSize(to) != 0 {
-		return false, nil
-	}
-
-	// Request file.
-	res, err := httpPost(url, values, cl)
-	if err != nil {
-		return false, fmt.Errorf("Failed to request file: %v", err)
-	}
-	defer res.Body.Close()
-	if res.StatusCode != http.StatusOK {
-		return false, fmt.Errorf("Got bad response status: %s", res.Status)
-	}
-
-	log.Printf("Downloading '%s' to '%s'.", url, to)
-
-	// Open output file.
-	out, err := os.Create(to)
-	if err != nil {
-		return false, fmt.Errorf("Failed to create output file: %v", err)
-	}
-	defer out.Close()
-	buf := bufio.NewWriter(out)
-	defer buf.Flush()
-
-	// Download!
-	_, err = io.Copy(buf, res.Body)
-	if err != nil {
-		return false, fmt.Errorf("Failed to save file: %v", err)
-	}
-
-	return true, nil
+// doneOnClose is a response body that releases its request's resources when
+// closed.
+type doneOnClose struct {
+	io.ReadCloser
+	done func()
+	once sync.Once
 }
 
-// A directory and a file. Surprised? So are we!
-type dirFile struct {
-	dir  string
-	file string
+func (c *doneOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.once.Do(c.done)
+	return err
 }
 
 // mkdirLock ensures that calls to os.MkDir are made sequentially.
@@ -263,26 +460,20 @@ func mkdir(path string) error {
 	return os.MkdirAll(path, 0700)
 }
 
-// storesFileTemplate indicates how tell a stores data file.
-var storesFileTemplate = regexp.MustCompile("(^|\\W)Stores\\d")
-
 // isStoresFile checks if a file's name looks like a stores data file.
 func isStoresFile(name string) bool {
-	return storesFileTemplate.FindAllString(name, 1) != nil
+	base := path.Base(name)
+	if info := filename.Parse(base); info != nil {
+		return info.Kind == filename.Stores
+	}
+	return filename.KindOf(base) == filename.Stores
 }
 
 // shouldDownloadFile tests if in the current cofiguration this file should be
 // downloaded.
 func shouldDownloadFile(name string) bool {
-	ts := fileTimestamp(name)
-	return ts != -1 && (ts >= fromTimestamp || isStoresFile(name))
-}
-
-// makeContext creates a context with common settings to this client.
-// All HTTP requests should use this context.
-func makeContext() context.Context {
-	ctx, _ := context.WithTimeout(context.Background(), httpTimeout)
-	return ctx
+	ts := filename.Timestamp(name)
+	return ts != -1 && inTimeRange(name, ts)
 }
 
 // ----- TIMESTAMP HANDLING ---------------------------------------------------
@@ -291,10 +482,14 @@ func makeContext() context.Context {
 // older than this timestamp are ignored.
 var fromTimestamp int64 = -1
 
+// toTimestamp is the maximal time until which we download. Files newer than
+// this timestamp are ignored.
+var toTimestamp int64 = -1
+
 // SetFromTimestamp sets the minimal time from which files will be downloaded.
 // Files older that this timestamp are ignored. Format is "YYYYMMDDhhmm".
 func SetFromTimestamp(s string) error {
-	t := fileTimestamp(s)
+	t := filename.Timestamp(s)
 	if t == -1 {
 		return fmt.Errorf("bad timestamp: %q, expected %q", s, "YYYYMMDDhhmm")
 	}
@@ -302,34 +497,59 @@ func SetFromTimestamp(s string) error {
 	return nil
 }
 
-// Infers the timestamp of a file according to its name. Returns -1 if failed.
-func fileTimestamp(file string) int64 {
-	match := regexp.MustCompile("(\\D|^)(20\\d{10})(\\D|$)").FindStringSubmatch(filepath.Base(file))
-	if match == nil || len(match[2]) != 12 {
-		return -1
+// SetToTimestamp sets the maximal time until which files will be downloaded,
+// inclusive. Files newer than this timestamp are ignored. Format is
+// "YYYYMMDDhhmm".
+func SetToTimestamp(s string) error {
+	t := filename.Timestamp(s)
+	if t == -1 {
+		return fmt.Errorf("bad timestamp: %q, expected %q", s, "YYYYMMDDhhmm")
+	}
+	if fromTimestamp != -1 && t < fromTimestamp {
+		return fmt.Errorf("bad timestamp: %q, must not be before the from "+
+			"timestamp", s)
 	}
-	digits := match[2]
-	year, _ := strconv.ParseInt(digits[0:4], 10, 64)
-	month, _ := strconv.ParseInt(digits[4:6], 10, 64)
-	day, _ := strconv.ParseInt(digits[6:8], 10, 64)
-	hour, _ := strconv.ParseInt(digits[8:10], 10, 64)
-	minute, _ := strconv.ParseInt(digits[10:12], 10, 64)
-	t := time.Date(int(year), time.Month(month), int(day), int(hour),
-		int(minute), 0, 0, time.UTC)
+	toTimestamp = t
+	return nil
+}
 
-	return t.Unix()
+// Returns true if the given timestamp of the named file is between the from
+// and to timestamps. Files with no timestamp (-1) are always in range. Stores
+// files are only checked against the to timestamp, since they are published
+// rarely and the one from before the from timestamp may still be in effect.
+func inTimeRange(name string, ts int64) bool {
+	if ts == -1 {
+		return true
+	}
+	if toTimestamp != -1 && ts > toTimestamp {
+		return false
+	}
+	return ts >= fromTimestamp || isStoresFile(name)
+}
+
+// Returns true if some of the day that starts at the given time is between the
+// from and to timestamps.
+func dayInTimeRange(day time.Time) bool {
+	if day.AddDate(0, 0, 1).Unix() <= fromTimestamp {
+		return false
+	}
+	return toTimestamp == -1 || day.Unix() <= toTimestamp
 }
 
 // expandPath replaces {{date}} in a path with an actual date, inferred from its timestamp.
 // If no timestamp can be inferred, returns the path as is.
 func expandPath(p string) string {
-	ts := fileTimestamp(p)
+	return expandPathTime(p, filename.Timestamp(p))
+}
+
+// expandPathTime replaces {{date}} in a path with the date of the given
+// timestamp, or with "unknown-date" if it is -1.
+func expandPathTime(p string, ts int64) string {
 	date := ""
 	if ts == -1 {
 		date = "unknown-date"
 	} else {
-		t := time.Unix(ts, 0).UTC()
-		date = t.Format("2006-01-02")
+		date = filename.Date(ts)
 	}
 	p = strings.Replace(p, "{{date}}", date, -1)
 	return p
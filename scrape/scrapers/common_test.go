@@ -1,7 +1,18 @@
 package scrapers
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
 	"testing"
+
+	"github.com/fluhus/prices/filename"
 )
 
 func TestIsStoresFile(t *testing.T) {
@@ -21,3 +32,126 @@ func TestIsStoresFile(t *testing.T) {
 		}
 	}
 }
+
+func TestInTimeRange(t *testing.T) {
+	defer func(from, to int64) {
+		fromTimestamp, toTimestamp = from, to
+	}(fromTimestamp, toTimestamp)
+	SetFromTimestamp("202610170000")
+	SetToTimestamp("202610172359")
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"Price7290027600007-001-202610171200.gz", true},
+		{"Price7290027600007-001-202610161200.gz", false},
+		{"Price7290027600007-001-202610181200.gz", false},
+		{"Stores7290027600007-202610161200.xml", true},
+		{"Stores7290027600007-202610181200.xml", false},
+	}
+	for _, test := range tests {
+		ts := filename.Timestamp(test.name)
+		if got := inTimeRange(test.name, ts); got != test.want {
+			t.Errorf("inTimeRange(%q)=%v want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	defer func(tr http.RoundTripper, cfg *tls.Config, hosts map[string]bool) {
+		transport, tlsConfig, insecureHosts = tr, cfg, hosts
+	}(transport, tlsConfig, insecureHosts)
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{
+		Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600)
+
+	tests := []struct {
+		c      TLSConfig
+		wantOK bool
+	}{
+		{TLSConfig{}, false},
+		{TLSConfig{CAFile: caFile}, true},
+		{TLSConfig{InsecureHosts: []string{"127.0.0.1"}}, true},
+		{TLSConfig{InsecureHosts: []string{"example.com"}}, false},
+	}
+	for i, test := range tests {
+		if err := SetTLSConfig(test.c); err != nil {
+			t.Fatalf("#%v: SetTLSConfig(%+v) failed: %v", i+1, test.c, err)
+		}
+		res, err := httpGet(context.Background(), srv.URL, nil)
+		if err == nil {
+			res.Body.Close()
+		}
+		if ok := err == nil; ok != test.wantOK {
+			t.Errorf("#%v: httpGet(...) with %+v returned %v, want ok=%v",
+				i+1, test.c, err, test.wantOK)
+		}
+	}
+}
+
+func TestPoolReusesConnections(t *testing.T) {
+	var conns int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("data"))
+		}))
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt32(&conns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	for i := 0; i < 5; i++ {
+		res, err := httpGet(context.Background(), srv.URL, nil)
+		if err != nil {
+			t.Fatalf("httpGet(...) failed: %v", err)
+		}
+		ioutil.ReadAll(res.Body)
+		res.Body.Close()
+	}
+	if n := atomic.LoadInt32(&conns); n != 1 {
+		t.Errorf("5 requests made %d connections, want 1", n)
+	}
+}
+
+func TestPoolConfigProxy(t *testing.T) {
+	defer func(tr http.RoundTripper, p PoolConfig) {
+		transport, poolConfig = tr, p
+	}(transport, poolConfig)
+
+	var got string
+	proxy := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			got = r.URL.String()
+		}))
+	defer proxy.Close()
+
+	p := DefaultPoolConfig
+	p.Proxy = proxy.URL
+	if err := SetPoolConfig(p); err != nil {
+		t.Fatalf("SetPoolConfig(%+v) failed: %v", p, err)
+	}
+	const url = "http://prices.example.com/file.gz"
+	res, err := httpGet(context.Background(), url, nil)
+	if err != nil {
+		t.Fatalf("httpGet(%q) failed: %v", url, err)
+	}
+	res.Body.Close()
+	if got != url {
+		t.Errorf("httpGet(%q) sent %q to the proxy, want %q", url, got, url)
+	}
+
+	for _, proxy := range []string{"proxy:3128", "://x"} {
+		p.Proxy = proxy
+		if err := SetPoolConfig(p); err == nil {
+			t.Errorf("SetPoolConfig(%+v) succeeded, want error", p)
+		}
+	}
+}
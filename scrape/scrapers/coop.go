@@ -3,40 +3,59 @@ package scrapers
 // A scraper for the Co-Op chain.
 
 import (
-	"bufio"
 	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	urllib "net/url"
-	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"time"
+
+	"github.com/fluhus/prices/filename"
+	"github.com/fluhus/prices/scrape/manifest"
 )
 
-type coopScraper struct{}
+// Home page of the Co-Op price site.
+const coopHome = "http://coopisrael.coop/"
+
+// A scraper for the Co-Op chain.
+type coopScraper struct {
+	home string // Site's homepage, normally coopHome.
+}
 
 // Returns a new Co-Op scraper.
 func Coop() Scraper {
-	return &coopScraper{}
+	return &coopScraper{coopHome}
 }
 
-func (a *coopScraper) Scrape(dir string) error {
+func (a *coopScraper) Scrape(ctx context.Context, dir string) error {
+	threads := threadsOf(ctx)
+
 	// Get files for download.
-	infos, infosDone := a.filesForDownload()
+	infos, infosDone := a.filesForDownload(ctx)
 
-	// Start downloader threads.
-	done := make(chan error, numberOfThreads)
-	for i := 0; i < numberOfThreads; i++ {
+	// Start downloader threads. A failed file does not stop the other files.
+	done := make(chan error, threads)
+	failed := &failures{}
+	for i := 0; i < threads; i++ {
 		go func() {
 			for info := range infos {
-				err := a.download(info.url, dir, info.values)
+				if ctx.Err() != nil {
+					done <- ctx.Err()
+					return
+				}
+				err := a.download(ctx, info.url, dir, info.values)
 				if err != nil {
-					log.Printf("Download error for '%v', branch %v: %v",
-						info.url, info.values["branch"], err)
-					continue
+					if ctx.Err() != nil {
+						done <- ctx.Err()
+						return
+					}
+					failed.add(ctx, fmt.Sprintf("%s branch %s", info.url,
+						info.values.Get("branch")), err)
 				}
 			}
 
@@ -46,7 +65,7 @@ func (a *coopScraper) Scrape(dir string) error {
 
 	// Wait for downloaders to finish.
 	var err error
-	for i := 0; i < numberOfThreads; i++ {
+	for i := 0; i < threads; i++ {
 		e := <-done
 		if e != nil {
 			err = e
@@ -61,9 +80,35 @@ func (a *coopScraper) Scrape(dir string) error {
 		err = e
 	}
 
+	if err == nil {
+		err = failed.err()
+	}
 	return err
 }
 
+// Co-Op names its files only in the responses to download requests, so listed
+// files are named after their request instead. For the same reason, the time
+// range does not apply to listed files. Scrape applies it once a file's name
+// is known, and drops the files that are out of range.
+func (a *coopScraper) List(ctx context.Context) ([]*RemoteFile, error) {
+	infos, infosDone := a.filesForDownload(ctx)
+	result := []*RemoteFile{}
+	for info := range infos {
+		name := path.Base(info.url)
+		if branch := info.values.Get("branch"); branch != "" {
+			name += "-" + branch
+		}
+		result = append(result, &RemoteFile{Name: name, URL: info.url})
+	}
+
+	err := <-infosDone
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
 // Information for a single download.
 type coopFileInfo struct {
 	url    string
@@ -72,9 +117,12 @@ type coopFileInfo struct {
 
 // Returns a channel that will yield file-infos for download. The error channel
 // will report when it's finished.
-func (a *coopScraper) filesForDownload() (chan *coopFileInfo, chan error) {
+func (a *coopScraper) filesForDownload(ctx context.Context) (
+	chan *coopFileInfo, chan error) {
+	threads := threadsOf(ctx)
+
 	// Instantiate channels.
-	infos := make(chan *coopFileInfo, numberOfThreads)
+	infos := make(chan *coopFileInfo, threads)
 	done := make(chan error, 1)
 
 	// Start file getter thread.
@@ -86,19 +134,22 @@ func (a *coopScraper) filesForDownload() (chan *coopFileInfo, chan error) {
 		defer func() { done <- err }()
 
 		// Get stores file.
-		infos <- &coopFileInfo{
-			"http://coopisrael.coop/home/branches_to_xml",
-			form("type", "1", "agree", "1"),
+		if wantFile(ctx, "Stores", "") {
+			infos <- &coopFileInfo{
+				a.home + "home/branches_to_xml",
+				form("type", "1", "agree", "1"),
+			}
 		}
 
 		// Get branches.
-		res, err := httpPost(
-			"http://coopisrael.coop/ajax/search_branch", nil, nil)
+		res, err := httpPost(ctx,
+			a.home+"ajax/search_branch", nil, nil)
 		if err != nil {
 			err = fmt.Errorf("Failed to request branches: %v", err)
 			return
 		}
 		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
 			err = fmt.Errorf("Failed to request branches: %s", res.Status)
 			return
 		}
@@ -114,7 +165,7 @@ func (a *coopScraper) filesForDownload() (chan *coopFileInfo, chan error) {
 		branchesRaw := regexp.MustCompile("data-id=\\\\\"(.+?)\\\\\"").
 			FindAllSubmatch(body, -1)
 		if len(branchesRaw) == 0 {
-			err = fmt.Errorf("Found 0 branches.")
+			err = savePage(ctx, res, body, fmt.Errorf("Found 0 branches."))
 			return
 		}
 		branches := make([]string, len(branchesRaw))
@@ -122,18 +173,24 @@ func (a *coopScraper) filesForDownload() (chan *coopFileInfo, chan error) {
 			branches[i] = string(branchesRaw[i][1])
 		}
 
-		log.Printf("Found %d branches.", len(branches))
+		logf(ctx, "Found %d branches.", len(branches))
 
 		// Push promos & prices.
+		// Co-Op publishes full files, filtered here since their names are
+		// known only when downloading.
 		for _, branch := range branches {
-			infos <- &coopFileInfo{
-				"http://coopisrael.coop/home/get_promo",
-				form("branch", branch, "type", "1", "agree", "1"),
+			if wantFile(ctx, "PromoFull", branch) {
+				infos <- &coopFileInfo{
+					a.home + "home/get_promo",
+					form("branch", branch, "type", "1", "agree", "1"),
+				}
 			}
-			infos <- &coopFileInfo{
-				"http://coopisrael.coop/home/get_prices",
-				form("branch", branch, "type", "1", "agree", "1",
-					"product", "0"),
+			if wantFile(ctx, "PriceFull", branch) {
+				infos <- &coopFileInfo{
+					a.home + "home/get_prices",
+					form("branch", branch, "type", "1", "agree", "1",
+						"product", "0"),
+				}
 			}
 		}
 	}()
@@ -141,16 +198,45 @@ func (a *coopScraper) filesForDownload() (chan *coopFileInfo, chan error) {
 	return infos, done
 }
 
-// Downloads a given file from Co-Op.
-func (a *coopScraper) download(url, dir string, values urllib.Values) error {
+// Downloads a given file from Co-Op, unless its timestamp is out of the time
+// range. Failed attempts are retried according to the retry policy.
+func (a *coopScraper) download(ctx context.Context, url, dir string,
+	values urllib.Values) error {
+	stats := statsOf(ctx)
+	stats.addListed()
+	start := time.Now()
+	entry := &manifest.Entry{URL: url}
+	err := withRetry(ctx, fmt.Sprintf("'%s' branch %v", url,
+		values["branch"]), func() error {
+		return a.downloadOnce(ctx, url, dir, values, entry)
+	})
+	if entry.Path != "" {
+		entry.Duration = time.Since(start).Seconds()
+		record(ctx, entry, err)
+	}
+	if err != nil {
+		stats.addFailed(err)
+	} else if entry.Path != "" {
+		stats.addDownloaded(fileSize(entry.Path))
+	}
+	return err
+}
+
+// Makes a single attempt to download a given file from Co-Op. Fills in the
+// entry's response details, and its path only if the file is in the time
+// range.
+func (a *coopScraper) downloadOnce(ctx context.Context, url, dir string,
+	values urllib.Values, entry *manifest.Entry) error {
 	// Open connection to site.
-	res, err := httpPost(url, values, nil)
+	res, err := httpPost(ctx, url, values, nil)
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
+	entry.Status = res.StatusCode
+	entry.LastModified = res.Header.Get("Last-Modified")
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("Failed to request file: Got status %s.", res.Status)
+		return newStatusError(res)
 	}
 
 	// Extract file name.
@@ -162,26 +248,29 @@ func (a *coopScraper) download(url, dir string, values urllib.Values) error {
 	if fileName == "" {
 		return fmt.Errorf("No file name in response.")
 	}
+	if !inTimeRange(fileName, filename.Timestamp(fileName)) {
+		logf(ctx, "Skipping '%s', out of the time range.", fileName)
+		return nil
+	}
 	fileName += ".gz"
 	to := expandPath(filepath.Join(dir, fileName))
+	entry.Path = to
 
-	log.Printf("Downloading '%s' to '%s'.", url, to)
-
-	// Open output file.
-	fout, err := os.Create(to)
-	if err != nil {
-		return fmt.Errorf("Failed to create output file: %v", err)
-	}
-	defer fout.Close()
-	bout := bufio.NewWriter(fout)
-	defer bout.Flush()
-	zout := gzip.NewWriter(bout)
-	defer zout.Close()
+	logf(ctx, "Downloading '%s' to '%s'.", url, to)
 
-	// Download!
-	_, err = io.Copy(zout, res.Body)
+	// Compress on the fly, so that a failed download leaves no file behind.
+	zin, zout := io.Pipe()
+	defer zin.Close()
+	go func() {
+		z := gzip.NewWriter(zout)
+		_, err := io.Copy(z, res.Body)
+		if err == nil {
+			err = z.Close()
+		}
+		zout.CloseWithError(err)
+	}()
 
-	return err
+	return saveFile(ctx, zin, to)
 }
 
 // Creates a values object for POST requests. Arguments are pairs of key and
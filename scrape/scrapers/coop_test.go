@@ -0,0 +1,163 @@
+package scrapers
+
+import (
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fluhus/prices/filename"
+)
+
+// Co-Op's files by request and branch.
+var coopFiles = map[string]string{
+	"branches_to_xml": "Stores7290633800006-202610170300.xml",
+	"get_promo-101":   "PromoFull7290633800006-101-202610170300.xml",
+	"get_prices-101":  "PriceFull7290633800006-101-202610170300.xml",
+	"get_promo-205":   "PromoFull7290633800006-205-202610170300.xml",
+	"get_prices-205":  "PriceFull7290633800006-205-202610170300.xml",
+}
+
+// Returns a fake Co-Op site that serves the given files by request and
+// branch.
+func newFakeCoop(t *testing.T, files map[string]string) *fakeSite {
+	s := newFakeSite(t)
+	s.page("/ajax/search_branch", "coop/search_branch.json")
+	s.handle("/home/", func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Path[len("/home/"):]
+		if branch := r.FormValue("branch"); branch != "" {
+			key += "-" + branch
+		}
+		file, ok := files[key]
+		if r.Method != "POST" || r.FormValue("agree") != "1" || !ok {
+			http.Error(w, "Bad request", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Disposition", "attachment; filename="+file+
+			"; charset=utf-8")
+		w.Write([]byte(fakeData(file)))
+	})
+	return s
+}
+
+func TestCoop(t *testing.T) {
+	s := newFakeCoop(t, coopFiles)
+	want := map[string]string{}
+	for name, file := range coopFiles {
+		want[file+".gz"] = name
+	}
+	checkCoop(t, &coopScraper{s.home()}, want)
+}
+
+func TestCoopFailures(t *testing.T) {
+	files := map[string]string{}
+	for key, file := range coopFiles {
+		if key != "get_prices-205" {
+			files[key] = file
+		}
+	}
+	s := newFakeCoop(t, files)
+	dir := t.TempDir()
+	if err := (&coopScraper{s.home()}).Scrape(context.Background(),
+		dir); err == nil {
+		t.Errorf("Scrape(...) succeeded with a failed file, want error")
+	}
+	infos, _ := ioutil.ReadDir(dir)
+	if len(infos) != len(files) {
+		t.Errorf("Scrape(...) saved %d files, want %d", len(infos),
+			len(files))
+	}
+}
+
+func TestCoopTimeRange(t *testing.T) {
+	defer func(from, to int64) {
+		fromTimestamp, toTimestamp = from, to
+	}(fromTimestamp, toTimestamp)
+
+	files := map[string]string{}
+	for key, file := range coopFiles {
+		files[key] = file
+	}
+	files["get_prices-205"] = "PriceFull7290633800006-205-202610160300.xml"
+	s := newFakeCoop(t, files)
+	if err := SetFromTimestamp("202610170000"); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := (&coopScraper{s.home()}).Scrape(context.Background(),
+		dir); err != nil {
+		t.Fatalf("Scrape(...) failed: %v", err)
+	}
+	infos, _ := ioutil.ReadDir(dir)
+	var names, want []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	for key, file := range coopFiles {
+		if key != "get_prices-205" {
+			want = append(want, file+".gz")
+		}
+	}
+	checkNames(t, "Scrape(...)", names, want)
+}
+
+// Checks that Co-Op lists the wanted files, and downloads them compressed.
+// Want maps downloaded files to listed names.
+func checkCoop(t *testing.T, a *coopScraper, want map[string]string) {
+	files, err := a.List(context.Background())
+	if err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+	var names, wantNames, wantFiles []string
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	for file, name := range want {
+		wantFiles = append(wantFiles, file)
+		wantNames = append(wantNames, name)
+	}
+	checkNames(t, "List()", names, wantNames)
+
+	// Scrape into a dated directory, like the scrape command does. All
+	// wanted files are from the same day.
+	root := t.TempDir()
+	err = a.Scrape(context.Background(), filepath.Join(root, "{{date}}",
+		"coop"))
+	if err != nil {
+		t.Fatalf("Scrape(...) failed: %v", err)
+	}
+	dir := filepath.Join(root, filename.Date(filename.Timestamp(wantFiles[0])),
+		"coop")
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names = nil
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	checkNames(t, "Scrape(...)", names, wantFiles)
+	for _, name := range names {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		z, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			t.Errorf("Scrape(...) saved a bad gzip file %s: %v", name, err)
+			continue
+		}
+		data, _ := ioutil.ReadAll(z)
+		f.Close()
+		plain := name[:len(name)-len(".gz")]
+		if string(data) != fakeData(plain) {
+			t.Errorf("Scrape(...) saved %q in %s, want %q", data, name,
+				fakeData(plain))
+		}
+	}
+}
@@ -0,0 +1,381 @@
+package scrapers
+
+// Downloading of data files.
+//
+// Files are downloaded into a temporary file with the partSuffix suffix, and
+// renamed to their final name only once the complete body has arrived. An
+// existing final file is therefore always complete. A temporary file that is
+// left behind by an interrupted download is resumed with a range request on
+// the next attempt, if the server supports it.
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	urllib "net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fluhus/prices/filename"
+	"github.com/fluhus/prices/scrape/manifest"
+)
+
+// partSuffix is appended to the names of files that are being downloaded.
+const partSuffix = ".part"
+
+// Downloads a file iff the 'to' path does not exist. Give a client for
+// logged-in sessions, or nil to start a new session. Returns true iff file was
+// downloaded.
+func downloadIfNotExists(ctx context.Context, url, to string,
+	cl *http.Client) (bool, error) {
+	return downloadIfNotExistsRequest(ctx, url, to, cl,
+		func() (*http.Request, error) {
+			return http.NewRequest("GET", url, nil)
+		}, nil)
+}
+
+// Downloads a file iff the 'to' path does not exist. Give a client for
+// logged-in sessions, or nil to start a new session. Values will be used as
+// POST form values. Returns true iff file was downloaded.
+func downloadIfNotExistsPost(ctx context.Context, url, to string,
+	cl *http.Client, values urllib.Values) (bool, error) {
+	return downloadIfNotExistsRequest(ctx, url, to, cl,
+		func() (*http.Request, error) {
+			return newPostRequest(url, values)
+		}, nil)
+}
+
+// Downloads a listed file into dir iff it does not exist, or exists with a
+// size other than the listed one. The listed time stands for the file's
+// timestamp if its name has none. Returns true iff file was downloaded.
+func downloadRemoteFile(ctx context.Context, dir string, file *RemoteFile,
+	cl *http.Client) (bool, error) {
+	return downloadIfNotExistsRequest(ctx, file.URL,
+		filepath.Join(dir, filepath.FromSlash(file.Name)), cl,
+		func() (*http.Request, error) {
+			return http.NewRequest("GET", file.URL, nil)
+		}, file)
+}
+
+// Downloads a file iff the 'to' path does not exist, using requests made by
+// newReq. Listed is the file's listing metadata, or nil if none. Returns true
+// iff file was downloaded.
+func downloadIfNotExistsRequest(ctx context.Context, url, to string,
+	cl *http.Client, newReq func() (*http.Request, error),
+	listed *RemoteFile) (bool, error) {
+	stats := statsOf(ctx)
+	stats.addListed()
+	ts := filename.Timestamp(to)
+	if ts == -1 && listed != nil {
+		ts = listed.timestamp()
+		to = expandPathTime(to, ts)
+	} else {
+		to = expandPath(to)
+	}
+	if ts == -1 || !inTimeRange(to, ts) {
+		return false, nil
+	}
+
+	// Create output directory.
+	err := mkdir(filepath.Dir(to))
+	if err != nil {
+		stats.addFailed(err)
+		return false, fmt.Errorf("Failed to make dir: %v", err)
+	}
+
+	// Check if file already exists. A file that was published again with
+	// another size is downloaded again.
+	if size := fileSize(to); size > 0 {
+		if listed == nil || listed.Size <= 0 || size == listed.Size {
+			record(ctx, &manifest.Entry{URL: url, Path: to, Skipped: true},
+				nil)
+			stats.addSkipped()
+			return false, nil
+		}
+		logf(ctx, "Size of '%s' is %d but listed as %d, downloading again.",
+			to, size, listed.Size)
+	}
+
+	// Request file.
+	if listed != nil && (listed.Size > 0 || !listed.Time.IsZero()) {
+		logf(ctx, "Listed '%s' with %s.", url, listed.describe())
+	}
+	start := time.Now()
+	info, err := fetchFile(ctx, url, to, cl, newReq)
+	record(ctx, &manifest.Entry{URL: url, Path: to, Status: info.status,
+		LastModified: info.lastModified,
+		Duration:     time.Since(start).Seconds()}, err)
+	if err != nil {
+		stats.addFailed(err)
+		return false, err
+	}
+	stats.addDownloaded(fileSize(to))
+
+	return true, nil
+}
+
+// Information about the response to the last attempt of a download.
+type fetchInfo struct {
+	status       int    // HTTP status, or 0 if no response.
+	lastModified string // Last-Modified header.
+}
+
+// fetchFile sends requests made by newReq and saves the response body to the
+// given path. Failed attempts are retried according to the retry policy, and
+// resume from where the previous attempt stopped when possible. The complete
+// file is validated before it gets the final path. The returned info is never
+// nil.
+func fetchFile(ctx context.Context, url, to string, cl *http.Client,
+	newReq func() (*http.Request, error)) (*fetchInfo, error) {
+	part := to + partSuffix
+	info := &fetchInfo{}
+	err := withRetry(ctx, fmt.Sprintf("'%s'", url), func() error {
+		*info = fetchInfo{}
+		offset := fileSize(part)
+		res, err := requestFrom(ctx, cl, newReq, offset)
+		if err != nil {
+			return fmt.Errorf("Failed to request file: %w", err)
+		}
+		defer res.Body.Close()
+		info.status = res.StatusCode
+		info.lastModified = res.Header.Get("Last-Modified")
+
+		// Expected size of the complete file.
+		size := responseSize(res)
+
+		switch {
+		case res.StatusCode == http.StatusPartialContent && offset > 0:
+			start, total := contentRange(res)
+			if start != offset {
+				return fmt.Errorf("Got range starting at %d, expected %d.",
+					start, offset)
+			}
+			size = total
+			logf(ctx, "Resuming '%s' to '%s' from byte %d.", url, to, offset)
+		case res.StatusCode == http.StatusOK:
+			offset = 0
+			logf(ctx, "Downloading '%s' to '%s'.", url, to)
+		default:
+			return newStatusError(res)
+		}
+
+		err = savePart(res.Body, part, offset, size)
+		if err != nil {
+			return err
+		}
+		err = acceptFile(ctx, part, to)
+		if err != nil {
+			return err
+		}
+		err = os.Rename(part, to)
+		if err != nil {
+			return fmt.Errorf("Failed to rename output file: %v", err)
+		}
+		return nil
+	})
+	return info, err
+}
+
+// Sends a request made by newReq, asking for the content starting at the
+// given offset if it is positive. If the server cannot satisfy the range,
+// the partial data is stale, so the whole content is requested instead.
+func requestFrom(ctx context.Context, cl *http.Client,
+	newReq func() (*http.Request, error), offset int64) (*http.Response,
+	error) {
+	req, err := newReq()
+	if err != nil {
+		return nil, err
+	}
+	if offset <= 0 {
+		return httpDo(ctx, req, cl)
+	}
+
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	res, err := httpDo(ctx, req, cl)
+	if err != nil || res.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		return res, err
+	}
+	res.Body.Close()
+
+	req, err = newReq()
+	if err != nil {
+		return nil, err
+	}
+	return httpDo(ctx, req, cl)
+}
+
+// Matches the value of a Content-Range header.
+var contentRangeTemplate = regexp.MustCompile(`^bytes (\d+)-\d+/(\d+|\*)$`)
+
+// Returns the start offset and the complete size from a response's
+// Content-Range header. Returns -1 for values that are not available.
+func contentRange(res *http.Response) (start, total int64) {
+	match := contentRangeTemplate.FindStringSubmatch(
+		res.Header.Get("Content-Range"))
+	if match == nil {
+		return -1, -1
+	}
+	start, _ = strconv.ParseInt(match[1], 10, 64)
+	total, err := strconv.ParseInt(match[2], 10, 64)
+	if err != nil {
+		total = -1
+	}
+	return start, total
+}
+
+// savePart writes r into the given temporary file, starting at offset. If size
+// is not -1, checks that the file ends up with exactly that many bytes. A
+// short file is kept for resuming, and a file that cannot be trusted is
+// removed.
+func savePart(r io.Reader, part string, offset, size int64) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_WRONLY | os.O_APPEND
+	}
+	out, err := os.OpenFile(part, flags, 0600)
+	if err != nil {
+		return fmt.Errorf("Failed to create output file: %v", err)
+	}
+	buf := bufio.NewWriter(out)
+
+	// Download!
+	n, err := io.Copy(buf, r)
+	if ferr := buf.Flush(); err == nil {
+		err = ferr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to save file: %w", err)
+	}
+
+	// Check that the body was complete.
+	if size != -1 && offset+n != size {
+		if offset+n > size {
+			os.Remove(part)
+		}
+		return fmt.Errorf("Failed to save file: got %d bytes, expected %d: %w",
+			offset+n, size, io.ErrUnexpectedEOF)
+	}
+
+	return nil
+}
+
+// saveFile copies r into a temporary file and renames it to the given path
+// once done and validated. The path's directory is created if needed. On
+// failure, the temporary file is removed so that no partial or invalid data is
+// left behind.
+func saveFile(ctx context.Context, r io.Reader, to string) error {
+	err := mkdir(filepath.Dir(to))
+	if err != nil {
+		return fmt.Errorf("Failed to make dir: %v", err)
+	}
+	part := to + partSuffix
+	err = savePart(r, part, 0, -1)
+	if err != nil {
+		os.Remove(part)
+		return err
+	}
+	err = acceptFile(ctx, part, to)
+	if err != nil {
+		os.Remove(part)
+		return err
+	}
+	err = os.Rename(part, to)
+	if err != nil {
+		os.Remove(part)
+		return fmt.Errorf("Failed to rename output file: %v", err)
+	}
+	return nil
+}
+
+// Downloads the given files into dir on several threads, skipping ones that
+// already exist. Give a client for logged-in sessions, or nil to start a new
+// session. A failed file does not stop the other files, and the last failure is
+// returned once all files are done.
+func downloadFiles(ctx context.Context, dir string, files []*RemoteFile,
+	cl *http.Client) error {
+	threads := threadsOf(ctx)
+	fileChan := make(chan *RemoteFile, threads)
+	done := make(chan error, threads)
+	failed := &failures{}
+
+	// Start downloader threads.
+	for i := 0; i < threads; i++ {
+		go func() {
+			for file := range fileChan {
+				_, err := downloadRemoteFile(ctx, dir, file, cl)
+				if err != nil {
+					if ctx.Err() != nil {
+						done <- ctx.Err()
+						return
+					}
+					failed.add(ctx, file.Name, err)
+				}
+			}
+			done <- nil
+		}()
+	}
+
+	// Push files to channel.
+	go func() {
+		for _, file := range files {
+			fileChan <- file
+		}
+		close(fileChan)
+	}()
+
+	// Wait for threads to finish.
+	var err error
+	for i := 0; i < threads; i++ {
+		e := <-done
+		if e != nil {
+			err = e
+		}
+	}
+
+	// Drain file channel.
+	for range fileChan {
+	}
+
+	if err == nil {
+		err = failed.err()
+	}
+
+	return err
+}
+
+// failures collects downloads that failed after all retries, so that one
+// failed file does not stop a scraper's threads. Safe for concurrent use.
+type failures struct {
+	mutex sync.Mutex
+	count int
+	last  error
+}
+
+// Logs a failed download of the given file and records it.
+func (f *failures) add(ctx context.Context, file string, err error) {
+	logf(ctx, "Failed to download '%s': %v", file, err)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.count++
+	f.last = err
+}
+
+// Returns an error summarizing the failed downloads, or nil if none failed.
+func (f *failures) err() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.count == 0 {
+		return nil
+	}
+	return fmt.Errorf("Failed to download %d files, last error: %v",
+		f.count, f.last)
+}
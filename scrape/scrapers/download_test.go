@@ -0,0 +1,50 @@
+package scrapers
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFetchFileResumes(t *testing.T) {
+	const data = "0123456789"
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			http.ServeContent(w, r, "file", time.Time{},
+				strings.NewReader(data))
+		}))
+	defer srv.Close()
+
+	tests := []struct {
+		part string // Content of a leftover partial file.
+	}{
+		{""},
+		{"01234"},
+		{"0123456789abc"}, // Longer than the file, cannot be resumed.
+	}
+	for i, test := range tests {
+		to := filepath.Join(t.TempDir(), "file")
+		if test.part != "" {
+			ioutil.WriteFile(to+partSuffix, []byte(test.part), 0600)
+		}
+		_, err := fetchFile(context.Background(), srv.URL, to, nil,
+			func() (*http.Request, error) {
+				return http.NewRequest("GET", srv.URL, nil)
+			})
+		if err != nil {
+			t.Errorf("#%v: fetchFile(...) failed: %v", i+1, err)
+			continue
+		}
+		if got, _ := ioutil.ReadFile(to); string(got) != data {
+			t.Errorf("#%v: fetchFile(...) saved %q want %q", i+1, got, data)
+		}
+		if fileExists(to + partSuffix) {
+			t.Errorf("#%v: fetchFile(...) left a partial file", i+1)
+		}
+	}
+}
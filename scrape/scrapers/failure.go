@@ -0,0 +1,109 @@
+package scrapers
+
+// Saving of pages that scrapers fail to parse.
+//
+// A parsing error alone does not tell whether the site was redesigned or just
+// answered with an error page. So when saving is on, the page is saved with
+// its URL and headers, in a directory per failure under a directory per chain.
+// The saved body can be used as is as a test fixture.
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Where to save pages that fail to parse. Empty means they are not saved.
+var failuresDir string
+
+// SetFailuresDir sets the directory where pages that fail to parse are saved,
+// under a directory per chain. Empty means they are not saved. Should be
+// called before scraping starts.
+func SetFailuresDir(dir string) {
+	failuresDir = dir
+}
+
+// Saves a page that failed to parse, with the response it came in and the
+// parsing error, if saving is on. The response's body should already be read
+// into body. Returns err, so that it can be used in return statements.
+func savePage(ctx context.Context, res *http.Response, body []byte,
+	err error) error {
+	if failuresDir == "" {
+		return err
+	}
+	chain := chainOf(ctx)
+	if chain == "" {
+		chain = "unknown"
+	}
+	dir, serr := newFailureDir(filepath.Join(failuresDir, chain))
+	if serr == nil {
+		serr = writePage(dir, res, body, err)
+	}
+	if serr != nil {
+		logf(ctx, "Failed to save the failing page: %v", serr)
+		return err
+	}
+	logf(ctx, "Saved the failing page to '%s'.", dir)
+	return err
+}
+
+// Creates a directory for a failure under parent, named after the current
+// time. Failures at the same time get numbered directories.
+func newFailureDir(parent string) (string, error) {
+	err := mkdir(parent)
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Join(parent, time.Now().Format("20060102-150405.000"))
+	dir := name
+	for i := 2; ; i++ {
+		err = os.Mkdir(dir, 0700)
+		if !os.IsExist(err) {
+			return dir, err
+		}
+		dir = fmt.Sprintf("%s-%d", name, i)
+	}
+}
+
+// Writes the response and the error to response.txt in dir, and the body to a
+// body file with an extension by its content type.
+func writePage(dir string, res *http.Response, body []byte,
+	reason error) error {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "Error: %v\n", reason)
+	if res.Request != nil {
+		fmt.Fprintf(buf, "%s %s\n", res.Request.Method, res.Request.URL)
+	}
+	fmt.Fprintf(buf, "%s %s\n", res.Proto, res.Status)
+	res.Header.Write(buf)
+	err := ioutil.WriteFile(filepath.Join(dir, "response.txt"), buf.Bytes(),
+		0600)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "body"+bodyExt(res)), body,
+		0600)
+}
+
+// Returns the file extension of the response's body, by its content type.
+func bodyExt(res *http.Response) string {
+	typ := strings.ToLower(res.Header.Get("Content-Type"))
+	switch {
+	case strings.Contains(typ, "html"):
+		return ".html"
+	case strings.Contains(typ, "json"):
+		return ".json"
+	case strings.Contains(typ, "xml"):
+		return ".xml"
+	case strings.HasPrefix(typ, "text/"):
+		return ".txt"
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,59 @@
+package scrapers
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSavePage(t *testing.T) {
+	defer SetFailuresDir("")
+	dir := t.TempDir()
+	SetFailuresDir(dir)
+
+	const page = "<html><body>Under maintenance</body></html>"
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(page))
+		}))
+	defer srv.Close()
+
+	a, err := LinkPage(LinkPageConfig{Page: srv.URL + "/prices",
+		Files: `\.gz$`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithChain(context.Background(), "eden")
+	for i := 0; i < 2; i++ {
+		if _, err := a.List(ctx); err == nil {
+			t.Fatalf("List() succeeded, want error")
+		}
+	}
+
+	saved, _ := filepath.Glob(filepath.Join(dir, "eden", "*"))
+	if len(saved) != 2 {
+		t.Fatalf("List() saved %v, want 2 failures", saved)
+	}
+	for _, failure := range saved {
+		body, err := ioutil.ReadFile(filepath.Join(failure, "body.html"))
+		if err != nil || string(body) != page {
+			t.Errorf("List() saved body %q,%v, want %q", body, err, page)
+		}
+		res, err := ioutil.ReadFile(filepath.Join(failure, "response.txt"))
+		if err != nil {
+			t.Fatalf("List() saved no response: %v", err)
+		}
+		for _, want := range []string{"Got 0 files.",
+			"GET " + srv.URL + "/prices", "200 OK", "Content-Type: text/html"} {
+			if !strings.Contains(string(res), want) {
+				t.Errorf("List() saved response %q, want it to contain %q",
+					res, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package scrapers
+
+// A fake site that serves recorded pages, for testing scrapers offline.
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	urllib "net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// A fakeSite serves recorded pages from the testdata directory. The text
+// {{site}} in served pages is replaced with the site's home URL.
+type fakeSite struct {
+	*httptest.Server
+	t   *testing.T
+	mux *http.ServeMux
+}
+
+// Returns a new running fake site, which is closed when the test ends. The
+// site is not rate limited.
+func newFakeSite(t *testing.T) *fakeSite {
+	mux := http.NewServeMux()
+	s := &fakeSite{httptest.NewServer(mux), t, mux}
+	t.Cleanup(s.Close)
+	u, _ := urllib.Parse(s.URL)
+	SetHostLimit(u.Host, HostLimit{})
+	return s
+}
+
+// Returns the site's home URL, ending with a slash.
+func (s *fakeSite) home() string {
+	return s.URL + "/"
+}
+
+// Handles requests to the given pattern.
+func (s *fakeSite) handle(pattern string,
+	f func(w http.ResponseWriter, r *http.Request)) {
+	s.mux.HandleFunc(pattern, f)
+}
+
+// Serves a recorded page on the given pattern.
+func (s *fakeSite) page(pattern, file string) {
+	s.handle(pattern, func(w http.ResponseWriter, r *http.Request) {
+		s.writePage(w, file)
+	})
+}
+
+// Writes a recorded page from the testdata directory.
+func (s *fakeSite) writePage(w http.ResponseWriter, file string) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", file))
+	if err != nil {
+		s.t.Errorf("Failed to read recorded page: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(bytes.Replace(data, []byte("{{site}}"), []byte(s.home()), -1))
+}
+
+// Serves data files under the given pattern, with fakeData as content.
+func (s *fakeSite) files(pattern string) {
+	s.handle(pattern, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, fakeData(path.Base(r.URL.Path)))
+	})
+}
+
+// Returns the content that fake sites serve for a data file.
+func fakeData(name string) string {
+	return "data of " + name
+}
+
+// Checks that the scraper lists exactly the wanted file names, and then
+// downloads them with their fake content. Names of files in subdirectories
+// include their directory.
+func checkScrape(t *testing.T, scrp Scraper, want ...string) {
+	ctx := context.Background()
+	files, err := scrp.List(ctx)
+	if err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name)
+	}
+	checkNames(t, "List()", names, want)
+
+	dir := t.TempDir()
+	if err := scrp.Scrape(ctx, dir); err != nil {
+		t.Fatalf("Scrape(...) failed: %v", err)
+	}
+	names = nil
+	err = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(dir, p)
+		names = append(names, filepath.ToSlash(name))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkNames(t, "Scrape(...)", names, want)
+	for _, name := range names {
+		data, _ := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if want := fakeData(path.Base(name)); string(data) != want {
+			t.Errorf("Scrape(...) saved %q in %s, want %q", data, name, want)
+		}
+	}
+}
+
+// Checks that got and want have the same names, in any order.
+func checkNames(t *testing.T, what string, got, want []string) {
+	got = append([]string{}, got...)
+	want = append([]string{}, want...)
+	sort.Strings(got)
+	sort.Strings(want)
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("%s got files %v, want %v", what, got, want)
+	}
+}
@@ -0,0 +1,139 @@
+package scrapers
+
+// Filtering of data files by type and store.
+//
+// The type and store of a file are inferred from its name, by the filename
+// package. Scrapers filter their listed files before anything is downloaded,
+// together with the time range filter.
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/fluhus/prices/filename"
+)
+
+// FileTypes are the types of data files, as they appear in file names.
+var FileTypes = filename.Kinds
+
+var (
+	wantedTypes  map[string]bool // Nil means all types.
+	wantedStores map[string]bool // Nil means all stores.
+)
+
+// SetFileTypes sets the types of files to download, out of FileTypes. Empty
+// means all types. Should be called before scraping starts.
+func SetFileTypes(types []string) error {
+	wanted, err := parseFileTypes(types)
+	if err != nil {
+		return err
+	}
+	wantedTypes = wanted
+	return nil
+}
+
+// fileTypesKey is the context key for the types of files to download.
+type fileTypesKey struct{}
+
+// WithFileTypes returns a context that makes scrapers under it download the
+// given types of files, out of FileTypes, instead of the ones given to
+// SetFileTypes. Empty means all types.
+func WithFileTypes(ctx context.Context, types []string) (context.Context,
+	error) {
+	wanted, err := parseFileTypes(types)
+	if err != nil {
+		return nil, err
+	}
+	return context.WithValue(ctx, fileTypesKey{}, wanted), nil
+}
+
+// Returns the types of files to download under ctx. Nil means all types.
+func typesOf(ctx context.Context) map[string]bool {
+	if types, ok := ctx.Value(fileTypesKey{}).(map[string]bool); ok {
+		return types
+	}
+	return wantedTypes
+}
+
+// Returns the given file types as a set, or nil if empty.
+func parseFileTypes(types []string) (map[string]bool, error) {
+	if len(types) == 0 {
+		return nil, nil
+	}
+	wanted := map[string]bool{}
+	for _, t := range types {
+		typ := filename.ParseKind(t)
+		if typ == "" {
+			return nil, fmt.Errorf("bad file type: %q, expected one of %s", t,
+				strings.Join(FileTypes, ","))
+		}
+		wanted[typ] = true
+	}
+	return wanted, nil
+}
+
+// storeIDPattern matches the store IDs given to SetStores.
+var storeIDPattern = regexp.MustCompile("^\\d+$")
+
+// SetStores sets the IDs of the stores whose files are downloaded. Files that
+// belong to no store, like stores files, are always downloaded. Empty means all
+// stores. Should be called before scraping starts.
+func SetStores(stores []string) error {
+	if len(stores) == 0 {
+		wantedStores = nil
+		return nil
+	}
+	wanted := map[string]bool{}
+	for _, s := range stores {
+		if !storeIDPattern.MatchString(s) {
+			return fmt.Errorf("bad store ID: %q, expected digits", s)
+		}
+		wanted[filename.StoreID(s)] = true
+	}
+	wantedStores = wanted
+	return nil
+}
+
+// Returns true if files of the given type and store pass the filters under
+// ctx. Store may be empty for files that belong to no store.
+func wantFile(ctx context.Context, typ, store string) bool {
+	if types := typesOf(ctx); types != nil && !types[typ] {
+		return false
+	}
+	if wantedStores != nil && store != "" &&
+		!wantedStores[filename.StoreID(store)] {
+		return false
+	}
+	return true
+}
+
+// Returns the files that pass the type and store filters, and whose timestamps
+// are in the time range. Files whose names cannot be parsed pass only if there
+// are no type and store filters.
+func filterFiles(ctx context.Context, files []*RemoteFile) []*RemoteFile {
+	types := typesOf(ctx)
+	if types == nil && wantedStores == nil && fromTimestamp == -1 &&
+		toTimestamp == -1 {
+		return files
+	}
+	result := []*RemoteFile{}
+	for _, file := range files {
+		if !inTimeRange(file.Name, file.timestamp()) {
+			continue
+		}
+		if types != nil || wantedStores != nil {
+			info := filename.Parse(file.Name)
+			if info == nil || !wantFile(ctx, info.Kind, info.Store) {
+				continue
+			}
+		}
+		result = append(result, file)
+	}
+	if len(result) < len(files) {
+		logf(ctx, "Skipping %d of %d files by type, store and time.",
+			len(files)-len(result), len(files))
+	}
+	return result
+}
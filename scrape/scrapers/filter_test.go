@@ -0,0 +1,88 @@
+package scrapers
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFilterFiles(t *testing.T) {
+	defer func() { wantedTypes, wantedStores = nil, nil }()
+	var files []*RemoteFile
+	for _, name := range []string{
+		"PriceFull7290027600007-001-202610170300.gz",
+		"PromoFull7290027600007-001-202610170300.gz",
+		"PriceFull7290027600007-002-202610170300.gz",
+		"Stores7290027600007-202610170100.xml",
+		"index.html",
+	} {
+		files = append(files, &RemoteFile{Name: name})
+	}
+
+	tests := []struct {
+		types  []string
+		stores []string
+		want   []string
+	}{
+		{nil, nil, []string{
+			"PriceFull7290027600007-001-202610170300.gz",
+			"PromoFull7290027600007-001-202610170300.gz",
+			"PriceFull7290027600007-002-202610170300.gz",
+			"Stores7290027600007-202610170100.xml",
+			"index.html",
+		}},
+		{[]string{"stores"}, nil, []string{
+			"Stores7290027600007-202610170100.xml",
+		}},
+		{nil, []string{"2"}, []string{
+			"PriceFull7290027600007-002-202610170300.gz",
+			"Stores7290027600007-202610170100.xml",
+		}},
+		{[]string{"PriceFull", "PromoFull"}, []string{"001"}, []string{
+			"PriceFull7290027600007-001-202610170300.gz",
+			"PromoFull7290027600007-001-202610170300.gz",
+		}},
+	}
+	for i, test := range tests {
+		if err := SetFileTypes(test.types); err != nil {
+			t.Fatalf("#%v: SetFileTypes(%v) failed: %v", i+1, test.types, err)
+		}
+		if err := SetStores(test.stores); err != nil {
+			t.Fatalf("#%v: SetStores(%v) failed: %v", i+1, test.stores, err)
+		}
+		var got []string
+		for _, file := range filterFiles(context.Background(), files) {
+			got = append(got, file.Name)
+		}
+		checkNames(t, "filterFiles(...)", got, test.want)
+	}
+
+	if err := SetFileTypes([]string{"Prices"}); err == nil {
+		t.Errorf("SetFileTypes([Prices]) succeeded, want error")
+	}
+	if err := SetStores([]string{"a1"}); err == nil {
+		t.Errorf("SetStores([a1]) succeeded, want error")
+	}
+
+	// Context types override the global ones.
+	if err := SetFileTypes([]string{"Stores"}); err != nil {
+		t.Fatalf("SetFileTypes([Stores]) failed: %v", err)
+	}
+	ctx, err := WithFileTypes(context.Background(), []string{"PromoFull"})
+	if err != nil {
+		t.Fatalf("WithFileTypes(...) failed: %v", err)
+	}
+	var got []string
+	for _, file := range filterFiles(ctx, files) {
+		got = append(got, file.Name)
+	}
+	checkNames(t, "filterFiles(...)", got, []string{
+		"PromoFull7290027600007-001-202610170300.gz"})
+	if !wantFile(context.Background(), "Stores", "") ||
+		wantFile(ctx, "Stores", "") {
+		t.Errorf("wantFile(...) ignored the context's types")
+	}
+	if _, err := WithFileTypes(context.Background(),
+		[]string{"Prices"}); err == nil {
+		t.Errorf("WithFileTypes([Prices]) succeeded, want error")
+	}
+}
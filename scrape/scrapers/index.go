@@ -0,0 +1,216 @@
+package scrapers
+
+// A scraper for sites that publish files in HTTP directory listings, like the
+// ones Apache and IIS generate.
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	urllib "net/url"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fluhus/prices/filename"
+)
+
+// An IndexConfig describes a site that publishes files in directory listings.
+type IndexConfig struct {
+	Home    string // URL of the top listing, ending with a slash.
+	Dirs    string // Regular expression of links to directories to enter.
+	Files   string // Regular expression of links to files to download.
+	DateDir string // Time layout of date directory names, e.g. "20060102". Optional.
+	Depth   int    // Levels of directories to enter below the top listing.
+}
+
+// A scraper for sites that publish files in directory listings.
+type indexScraper struct {
+	home    string
+	dirs    *regexp.Regexp
+	files   *regexp.Regexp
+	dateDir string
+	depth   int
+}
+
+// Returns a new scraper for the site that the config describes. Files are
+// looked for in the top listing and in directories down to the configured
+// depth. Date directories with dates outside the from and to timestamps are
+// skipped.
+func Index(c IndexConfig) (Scraper, error) {
+	if !strings.HasSuffix(c.Home, "/") {
+		return nil, fmt.Errorf("bad home: %q, must end with a slash", c.Home)
+	}
+	if c.Depth < 0 {
+		return nil, fmt.Errorf("bad depth: %d, must be non-negative",
+			c.Depth)
+	}
+	dirs, err := regexp.Compile(c.Dirs)
+	if err != nil {
+		return nil, fmt.Errorf("bad directory pattern: %v", err)
+	}
+	files, err := regexp.Compile(c.Files)
+	if err != nil {
+		return nil, fmt.Errorf("bad file pattern: %v", err)
+	}
+	return &indexScraper{c.Home, dirs, files, c.DateDir, c.Depth}, nil
+}
+
+func (a *indexScraper) Scrape(ctx context.Context, dir string) error {
+	files, err := a.List(ctx)
+	if err != nil {
+		return err
+	}
+	return downloadFiles(ctx, dir, files, nil)
+}
+
+func (a *indexScraper) List(ctx context.Context) ([]*RemoteFile, error) {
+	result := []*RemoteFile{}
+	dirs := []string{a.home}
+	for level := 0; len(dirs) > 0; level++ {
+		files, subdirs, err := a.readDirs(ctx, dirs, level < a.depth)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, files...)
+		if len(subdirs) > 0 {
+			logf(ctx, "Found %d directories.", len(subdirs))
+		}
+		dirs = subdirs
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("Found no files.")
+	}
+
+	return filterFiles(ctx, result), nil
+}
+
+// Reads the given directory listings on several threads. Returns the files
+// in them, and their subdirectories if wanted.
+func (a *indexScraper) readDirs(ctx context.Context, dirs []string,
+	wantDirs bool) ([]*RemoteFile, []string, error) {
+	threads := threadsOf(ctx)
+	dirChan := make(chan string, threads)
+	done := make(chan error, threads)
+	var files []*RemoteFile
+	var subdirs []string
+	var lock sync.Mutex // Guards files and subdirs.
+
+	// Start reader threads.
+	for i := 0; i < threads; i++ {
+		go func() {
+			for dir := range dirChan {
+				f, d, err := a.readDir(ctx, dir)
+				if err != nil {
+					done <- fmt.Errorf("Failed to read directory %s: %v",
+						dir, err)
+					return
+				}
+				lock.Lock()
+				files = append(files, f...)
+				if wantDirs {
+					subdirs = append(subdirs, d...)
+				}
+				lock.Unlock()
+			}
+			done <- nil
+		}()
+	}
+
+	// Push directories to channel.
+	go func() {
+		for _, dir := range dirs {
+			dirChan <- dir
+		}
+		close(dirChan)
+	}()
+
+	// Wait for threads to finish.
+	var err error
+	for i := 0; i < threads; i++ {
+		e := <-done
+		if e != nil {
+			err = e
+		}
+	}
+
+	// Drain directory channel.
+	for range dirChan {
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+	return files, subdirs, nil
+}
+
+// Returns the files and the subdirectories that the given listing links to.
+func (a *indexScraper) readDir(ctx context.Context, dir string) (
+	[]*RemoteFile, []string, error) {
+	res, err := httpGet(ctx, dir, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("Failed to get page (status %s).",
+			res.Status)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	base, err := urllib.Parse(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var files []*RemoteFile
+	var dirs []string
+	links := regexp.MustCompile("<a [^>]*?href=\"([^\"]*)\"").
+		FindAllSubmatch(body, -1)
+	for _, link := range links {
+		href := string(link[1])
+		ref, err := urllib.Parse(href)
+		if err != nil {
+			continue
+		}
+		url := base.ResolveReference(ref).String()
+
+		switch {
+		case a.files.MatchString(href):
+			files = append(files, &RemoteFile{Name: path.Base(ref.Path),
+				URL: url})
+		case a.dirs.MatchString(href):
+			// Stay below the current directory, so parent links are ignored.
+			if !strings.HasPrefix(url, dir) || url == dir ||
+				a.isSkippedDateDir(path.Base(ref.Path)) {
+				continue
+			}
+			if !strings.HasSuffix(url, "/") {
+				url += "/"
+			}
+			dirs = append(dirs, url)
+		}
+	}
+
+	return files, dirs, nil
+}
+
+// Returns true if name is a date directory whose whole day is outside the
+// from and to timestamps.
+func (a *indexScraper) isSkippedDateDir(name string) bool {
+	if a.dateDir == "" {
+		return false
+	}
+	t, err := time.ParseInLocation(a.dateDir, name,
+		filename.Location())
+	if err != nil {
+		return false
+	}
+	return !dayInTimeRange(t)
+}
@@ -0,0 +1,86 @@
+package scrapers
+
+import (
+	"net/http"
+	"path"
+	"strings"
+	"testing"
+)
+
+// Returns a fake site with directory listings, as recorded in the given
+// testdata directory. The listing of /a/b/ is recorded in a_b.html, and the
+// listing of / in index.html.
+func newFakeIndex(t *testing.T, dir string) *fakeSite {
+	s := newFakeSite(t)
+	s.handle("/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/":
+			s.writePage(w, dir+"/index.html")
+		case strings.HasSuffix(r.URL.Path, "/"):
+			name := strings.Trim(r.URL.Path, "/")
+			s.writePage(w, dir+"/"+strings.Replace(name, "/", "_", -1)+
+				".html")
+		default:
+			w.Write([]byte(fakeData(path.Base(r.URL.Path))))
+		}
+	})
+	return s
+}
+
+func TestIndex(t *testing.T) {
+	s := newFakeIndex(t, "mega")
+	a, err := Index(IndexConfig{Home: s.home(), Dirs: `^2\d{7}/$`,
+		Files: `\.(gz|xml)$`, DateDir: "20060102", Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkScrape(t, a,
+		"Price7290055700007-0030-202610162300.gz",
+		"Stores7290055700007-202610160100.xml",
+		"PriceFull7290055700007-0030-202610170300.gz",
+		"PromoFull7290055700007-0030-202610170300.gz",
+	)
+}
+
+func TestIndexSubdirs(t *testing.T) {
+	s := newFakeIndex(t, "zolbegadol")
+	a, err := Index(IndexConfig{Home: s.home(), Dirs: `^(2\d{7}|gz)/$`,
+		Files: `\.gz$`, DateDir: "20060102", Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkScrape(t, a,
+		"Price7290058173198-001-202610170300.gz",
+		"PromoFull7290058173198-001-202610170300.gz",
+	)
+}
+
+func TestIndexDateRange(t *testing.T) {
+	defer func(from, to int64) {
+		fromTimestamp, toTimestamp = from, to
+	}(fromTimestamp, toTimestamp)
+
+	s := newFakeIndex(t, "mega")
+	a, err := Index(IndexConfig{Home: s.home(), Dirs: `^2\d{7}/$`,
+		Files: `\.(gz|xml)$`, DateDir: "20060102", Depth: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := SetFromTimestamp("202610170000"); err != nil {
+		t.Fatal(err)
+	}
+	checkScrape(t, a,
+		"PriceFull7290055700007-0030-202610170300.gz",
+		"PromoFull7290055700007-0030-202610170300.gz",
+	)
+
+	fromTimestamp = -1
+	if err := SetToTimestamp("202610162359"); err != nil {
+		t.Fatal(err)
+	}
+	checkScrape(t, a,
+		"Price7290055700007-0030-202610162300.gz",
+		"Stores7290055700007-202610160100.xml",
+	)
+}
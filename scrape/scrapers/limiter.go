@@ -0,0 +1,238 @@
+package scrapers
+
+// Rate limiting of requests, per host and globally.
+//
+// All requests go through httpDo, which waits for a free slot of the
+// request's host, a free global slot and a token from the host's bucket. Slots
+// are held until the response body is closed. Limiters are shared by all
+// scrapers, so chains that are scraped at the same time from the same host are
+// throttled together.
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A HostLimit restricts the requests sent to a single host.
+type HostLimit struct {
+	Rate        float64 // Requests per second. 0 means unlimited.
+	Burst       int     // Requests that can be sent at once after idle time.
+	MaxInFlight int     // Requests open at the same time. 0 means unlimited.
+}
+
+// DefaultHostLimit is the limit of hosts that have no specific limit.
+var DefaultHostLimit = HostLimit{Rate: 5, Burst: 5, MaxInFlight: 4}
+
+var (
+	defaultHostLimit = DefaultHostLimit
+	hostLimits       = map[string]HostLimit{} // Host-specific limits.
+	hostLimiters     = map[string]*limiter{}  // Created lazily per host.
+	hostLimitersLock sync.Mutex               // Guards the maps above.
+	globalSlots      chan struct{}            // Nil if unlimited.
+)
+
+// SetDefaultHostLimit sets the limit of hosts that have no specific limit.
+// Should be called before scraping starts.
+func SetDefaultHostLimit(l HostLimit) error {
+	if err := l.check(); err != nil {
+		return err
+	}
+	defaultHostLimit = l
+	return nil
+}
+
+// SetHostLimit sets the limit of a specific host, e.g.
+// "url.publishedprices.co.il". Should be called before scraping starts.
+func SetHostLimit(host string, l HostLimit) error {
+	if err := l.check(); err != nil {
+		return fmt.Errorf("host %q: %v", host, err)
+	}
+	hostLimits[host] = l
+	return nil
+}
+
+// SetMaxInFlight sets the maximal number of requests that are open at the
+// same time, across all hosts. 0 means unlimited. Should be called before
+// scraping starts.
+func SetMaxInFlight(n int) error {
+	if n < 0 {
+		return fmt.Errorf("bad number of requests: %d, must be non-negative",
+			n)
+	}
+	if n == 0 {
+		globalSlots = nil
+	} else {
+		globalSlots = make(chan struct{}, n)
+	}
+	return nil
+}
+
+// SetThreads sets the number of threads each scraper downloads on. Should be
+// called before scraping starts.
+func SetThreads(n int) error {
+	if n < 1 {
+		return fmt.Errorf("bad number of threads: %d, must be positive", n)
+	}
+	numberOfThreads = n
+	return nil
+}
+
+// ParseHostLimits parses host-specific limits from a comma separated list of
+// host=rate/inflight entries, e.g. "url.publishedprices.co.il=2/4", and sets
+// them.
+func ParseHostLimits(s string) error {
+	for _, entry := range strings.Split(s, ",") {
+		parts := strings.Split(entry, "=")
+		if len(parts) != 2 {
+			return fmt.Errorf("bad host limit: %q, expected %q", entry,
+				"host=rate/inflight")
+		}
+		values := strings.Split(parts[1], "/")
+		if len(values) != 2 {
+			return fmt.Errorf("bad host limit: %q, expected %q", entry,
+				"host=rate/inflight")
+		}
+		rate, err := strconv.ParseFloat(values[0], 64)
+		if err != nil {
+			return fmt.Errorf("bad host limit: %q: %v", entry, err)
+		}
+		inFlight, err := strconv.Atoi(values[1])
+		if err != nil {
+			return fmt.Errorf("bad host limit: %q: %v", entry, err)
+		}
+		burst := int(rate)
+		if burst < 1 {
+			burst = 1
+		}
+		err = SetHostLimit(parts[0], HostLimit{rate, burst, inFlight})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks that the limit's values are valid.
+func (l HostLimit) check() error {
+	if l.Rate < 0 || l.MaxInFlight < 0 {
+		return fmt.Errorf("bad limit: %+v, values must be non-negative", l)
+	}
+	if l.Rate > 0 && l.Burst < 1 {
+		return fmt.Errorf("bad limit: %+v, burst must be positive", l)
+	}
+	return nil
+}
+
+// A limiter is a token bucket with a bound on requests in flight.
+type limiter struct {
+	rate   float64       // Tokens added per second.
+	burst  float64       // Bucket size.
+	slots  chan struct{} // Nil if unlimited.
+	mutex  sync.Mutex    // Guards the fields below.
+	tokens float64       // Negative when requests are waiting.
+	last   time.Time     // Last time tokens were updated.
+}
+
+// Returns a new limiter that enforces the given limit.
+func newLimiter(l HostLimit) *limiter {
+	result := &limiter{rate: l.Rate, burst: float64(l.Burst),
+		tokens: float64(l.Burst), last: time.Now()}
+	if l.MaxInFlight > 0 {
+		result.slots = make(chan struct{}, l.MaxInFlight)
+	}
+	return result
+}
+
+// Returns the limiter of the given host.
+func hostLimiter(host string) *limiter {
+	hostLimitersLock.Lock()
+	defer hostLimitersLock.Unlock()
+	if l, ok := hostLimiters[host]; ok {
+		return l
+	}
+	l, ok := hostLimits[host]
+	if !ok {
+		l = defaultHostLimit
+	}
+	hostLimiters[host] = newLimiter(l)
+	return hostLimiters[host]
+}
+
+// Waits until a request may be sent to the given host. On success, the
+// returned function must be called once the request is done.
+func acquire(ctx context.Context, host string) (func(), error) {
+	l := hostLimiter(host)
+	if err := takeSlot(ctx, l.slots); err != nil {
+		return nil, err
+	}
+	if err := takeSlot(ctx, globalSlots); err != nil {
+		freeSlot(l.slots)
+		return nil, err
+	}
+	release := func() {
+		freeSlot(globalSlots)
+		freeSlot(l.slots)
+	}
+	if err := l.wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// Takes a slot from the given channel, unless it is nil.
+func takeSlot(ctx context.Context, slots chan struct{}) error {
+	if slots == nil {
+		return nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Frees a slot taken by takeSlot.
+func freeSlot(slots chan struct{}) {
+	if slots != nil {
+		<-slots
+	}
+}
+
+// Waits for a token from the bucket.
+func (l *limiter) wait(ctx context.Context) error {
+	if l.rate == 0 {
+		return nil
+	}
+
+	// Reserve a token, possibly one that is yet to be added.
+	l.mutex.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mutex.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		// Give the reservation back.
+		l.mutex.Lock()
+		l.tokens++
+		l.mutex.Unlock()
+		return ctx.Err()
+	}
+}
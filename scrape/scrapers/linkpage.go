@@ -0,0 +1,136 @@
+package scrapers
+
+// A scraper for sites that list their files as links in a single page.
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	urllib "net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Default link selector, matches the targets of anchor tags.
+const defaultLinks = "<a [^>]*?href=\"([^\"]*)\""
+
+// A LinkPageConfig describes a site that lists its files in a single page.
+type LinkPageConfig struct {
+	Page     string // URL of the page with the file list.
+	Links    string // Regular expression whose first group is a link target. Optional.
+	Files    string // Regular expression of link targets to download.
+	Download string // Base URL of relative links. Optional, default the page's URL.
+}
+
+// A scraper for sites that list their files in a single page.
+type linkPageScraper struct {
+	page     string
+	links    *regexp.Regexp
+	files    *regexp.Regexp
+	download string
+}
+
+// Returns a new scraper for the site that the config describes. Links that
+// the selector finds but do not match the file pattern are ignored. Their
+// count is reported in the log, and the links themselves only if no file
+// links were found.
+func LinkPage(c LinkPageConfig) (Scraper, error) {
+	if c.Page == "" {
+		return nil, fmt.Errorf("missing page")
+	}
+	if c.Links == "" {
+		c.Links = defaultLinks
+	}
+	if c.Download == "" {
+		c.Download = c.Page
+	}
+	links, err := regexp.Compile(c.Links)
+	if err != nil {
+		return nil, fmt.Errorf("bad link pattern: %v", err)
+	}
+	if links.NumSubexp() < 1 {
+		return nil, fmt.Errorf("bad link pattern: %q, must have a group",
+			c.Links)
+	}
+	files, err := regexp.Compile(c.Files)
+	if err != nil {
+		return nil, fmt.Errorf("bad file pattern: %v", err)
+	}
+	return &linkPageScraper{c.Page, links, files, c.Download}, nil
+}
+
+func (a *linkPageScraper) Scrape(ctx context.Context, dir string) error {
+	files, err := a.List(ctx)
+	if err != nil {
+		return err
+	}
+	return downloadFiles(ctx, dir, files, nil)
+}
+
+func (a *linkPageScraper) List(ctx context.Context) ([]*RemoteFile, error) {
+	res, body, links, err := a.linkList(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get file list: %v", err)
+	}
+	base, err := urllib.Parse(a.download)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to parse download URL: %v", err)
+	}
+
+	result := []*RemoteFile{}
+	var ignored []string
+	for _, link := range links {
+		ref, err := urllib.Parse(link)
+		if err != nil || !a.files.MatchString(link) {
+			ignored = append(ignored, link)
+			continue
+		}
+		result = append(result, &RemoteFile{Name: path.Base(ref.Path),
+			URL: base.ResolveReference(ref).String()})
+	}
+
+	// Finding no files may mean that the page had changed, then the ignored
+	// links help to tell how.
+	if len(result) == 0 {
+		if len(ignored) > 0 {
+			logf(ctx, "Ignored %d links that are not files: %s", len(ignored),
+				strings.Join(ignored, " "))
+		}
+		return nil, savePage(ctx, res, body, fmt.Errorf("Got 0 files."))
+	}
+	if len(ignored) > 0 {
+		logf(ctx, "Ignored %d links that are not files.", len(ignored))
+	}
+
+	return filterFiles(ctx, result), nil
+}
+
+// Returns the targets of all links in the page, with the response and the
+// body of the page.
+func (a *linkPageScraper) linkList(ctx context.Context) (*http.Response,
+	[]byte, []string, error) {
+	// Get page.
+	res, err := httpGet(ctx, a.page, nil)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Failed to get page: %v", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, nil, nil, fmt.Errorf("Failed to get page (status %s).",
+			res.Status)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("Failed to read page: %v", err)
+	}
+
+	// Parse links.
+	result := []string{}
+	for _, link := range a.links.FindAllSubmatch(body, -1) {
+		result = append(result, string(link[1]))
+	}
+
+	return res, body, result, nil
+}
@@ -0,0 +1,65 @@
+package scrapers
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestLinkPage(t *testing.T) {
+	s := newFakeSite(t)
+	s.page("/index", "eden/index.html")
+	s.files("/")
+	a, err := LinkPage(LinkPageConfig{Page: s.home() + "index",
+		Files: `\.zip$`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkScrape(t, a,
+		"PriceFull7290055755557-001-202610170300.zip",
+		"PromoFull7290055755557-001-202610170300.zip",
+		"Stores7290055755557-202610170100.zip",
+	)
+}
+
+func TestLinkPageDownloadBase(t *testing.T) {
+	s := newFakeSite(t)
+	s.page("/pirce_update", "bitan/pirce_update.html")
+	s.files("/upload/")
+	a, err := LinkPage(LinkPageConfig{Page: s.home() + "pirce_update",
+		Files: `^/upload/.*\.zip$`, Download: s.home()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkScrape(t, a,
+		"Price7290725900003-001-202610170300.zip",
+		"PromoFull7290725900003-001-202610170300.zip",
+	)
+}
+
+func TestLinkPageIgnoresOtherLinks(t *testing.T) {
+	s := newFakeSite(t)
+	s.handle("/index", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<a href="PriceFull7290055755557-001-202610170300.zip">` +
+			`<a href="/Error.aspx">`))
+	})
+	a, err := LinkPage(LinkPageConfig{Page: s.home() + "index",
+		Files: `\.zip$`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := a.List(context.Background())
+	if err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+	if len(files) != 1 || files[0].Name !=
+		"PriceFull7290055755557-001-202610170300.zip" {
+		t.Errorf("List()=%v want only the zip file", files)
+	}
+
+	if _, err := LinkPage(LinkPageConfig{Page: s.home() + "index",
+		Links: "<a", Files: `\.zip$`}); err == nil {
+		t.Errorf("LinkPage() with a link pattern without groups succeeded," +
+			" want error")
+	}
+}
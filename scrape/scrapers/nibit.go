@@ -3,21 +3,22 @@ package scrapers
 // A scraper for Nibit-based chains.
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	urllib "net/url"
-	"path/filepath"
 	"regexp"
+	"strings"
 	"time"
+
+	"github.com/fluhus/prices/filename"
 )
 
 const (
-	nibitHome     = "http://matrixcatalog.co.il/"               // For cookies.
-	nibitPage     = nibitHome + "NBCompetitionRegulations.aspx" // For queries.
-	nibitDownload = "http://matrixcatalog.co.il/" +
-		"CompetitionRegulationsFiles/latest/" // For downloads.
+	nibitHome     = "http://matrixcatalog.co.il/"         // For cookies.
+	nibitPage     = "NBCompetitionRegulations.aspx"       // For queries, relative to home.
+	nibitDownload = "CompetitionRegulationsFiles/latest/" // For downloads, relative to home.
 )
 
 // Chain ID's for filtering.
@@ -27,47 +28,142 @@ const (
 	Lahav   = "7290058179503"
 )
 
+// Chain value of the query form that selects all chains.
+const nibitAllChains = "-1"
+
 // Scrapes data from Nibit.
 type nibitScraper struct {
-	chain string // Name of chain.
-	days  int    // How many days from now back it should download.
+	home  string       // Site's homepage, normally nibitHome.
+	chain string       // Name of chain.
+	days  int          // How many days back it should download.
+	cl    *http.Client // Client with a session, kept between runs.
+
+	// For all chains mode, chain IDs that should not be reported.
+	known map[string]bool
 }
 
 // Returns a new Nibit scraper. Chain is an ID. Days is how many days back
 // from today it should download. days=1 means today only, days=2 means today
-// and yesterday, etc. A value lesser than 1 will cause a panic.
+// and yesterday, etc. A value lesser than 1 will cause a panic. The from and
+// to timestamps, when set, bound the dates instead.
 func Nibit(chain string, days int) Scraper {
 	// Check days.
 	if days < 1 {
 		panic(fmt.Sprintf("Bad number of days: %d. Must be positive.", days))
 	}
 
-	return &nibitScraper{chain, days}
+	return &nibitScraper{home: nibitHome, chain: chain, days: days}
 }
 
-func (a *nibitScraper) Scrape(dir string) error {
-	log.Print("Starting session.")
-	cl, err := a.startSession()
+// Returns a new Nibit scraper for all chains on the portal. Files are saved in
+// a directory per chain, named after its ID. Chains on the portal that are not
+// in known are reported in the log, once per scraper.
+func NibitAll(days int, known []string) Scraper {
+	result := Nibit(nibitAllChains, days).(*nibitScraper)
+	result.known = map[string]bool{}
+	for _, chain := range known {
+		result.known[chain] = true
+	}
+	return result
+}
+
+func (a *nibitScraper) Scrape(ctx context.Context, dir string) error {
+	return a.forEachDate(ctx, func(cl *http.Client, date string) error {
+		files, err := a.listDate(ctx, cl, date)
+		if err != nil {
+			return err
+		}
+		return downloadFiles(ctx, dir, files, cl)
+	})
+}
+
+func (a *nibitScraper) List(ctx context.Context) ([]*RemoteFile, error) {
+	var result []*RemoteFile
+	err := a.forEachDate(ctx, func(cl *http.Client, date string) error {
+		files, err := a.listDate(ctx, cl, date)
+		result = append(result, files...)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("Failed to start session: %v", err)
+		return nil, err
 	}
+	return result, nil
+}
 
-	for i := 0; i < a.days; i++ {
-		date := a.formatDate(time.Now().AddDate(0, 0, -i*1))
-		log.Printf("Downloading files from %s.", date)
-		err = a.download(cl, date, dir)
+// Calls f for each date to scrape, from the latest back, with a client that
+// has a session. Stops at the first error.
+func (a *nibitScraper) forEachDate(ctx context.Context,
+	f func(cl *http.Client, date string) error) error {
+	// Reuse the session of a previous run, if any. A new session is trusted
+	// to work.
+	checked := a.cl == nil
+	if checked {
+		if err := a.newSession(ctx); err != nil {
+			return err
+		}
+	}
+
+	for _, day := range a.dates() {
+		date := a.formatDate(day)
+		logf(ctx, "Handling files from %s.", date)
+		err := f(a.cl, date)
+
+		// An old session may have expired, so try once with a new one.
+		if err != nil && !checked && ctx.Err() == nil {
+			logf(ctx, "Previous session failed, starting again: %v", err)
+			checked = true
+			if err := a.newSession(ctx); err != nil {
+				return err
+			}
+			err = f(a.cl, date)
+		}
 		if err != nil {
 			return err
 		}
+		checked = true
 	}
 
 	return nil
 }
 
+// Returns the dates to scrape, from the latest back. These are the dates
+// between the from and to timestamps. A missing bound is replaced by today,
+// or by the configured number of days before the latest date. Days are in the
+// time zone of file names.
+func (a *nibitScraper) dates() []time.Time {
+	last := filename.Day(time.Now())
+	if toTimestamp != -1 {
+		last = filename.Day(time.Unix(toTimestamp, 0))
+	}
+	first := last.AddDate(0, 0, 1-a.days)
+	if fromTimestamp != -1 {
+		first = filename.Day(time.Unix(fromTimestamp, 0))
+	}
+
+	var result []time.Time
+	for day := last; !day.Before(first); day = day.AddDate(0, 0, -1) {
+		result = append(result, day)
+	}
+	return result
+}
+
+// Starts a new session and keeps it for following runs.
+func (a *nibitScraper) newSession(ctx context.Context) error {
+	logf(ctx, "Starting session.")
+	a.cl = nil
+	cl, err := a.startSession(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to start session: %v", err)
+	}
+	a.cl = cl
+	return nil
+}
+
 // Returns a client with a session ID cookie.
-func (a *nibitScraper) startSession() (*http.Client, error) {
+func (a *nibitScraper) startSession(ctx context.Context) (*http.Client,
+	error) {
 	// Get homepage.
-	res, err := http.Head(nibitPage)
+	res, err := httpHead(ctx, a.home+nibitPage, nil)
 	if err != nil {
 		return nil, fmt.Errorf("Failed to request homepage: %v", err)
 	}
@@ -83,7 +179,7 @@ func (a *nibitScraper) startSession() (*http.Client, error) {
 		return nil, fmt.Errorf("Failed to get session ID.")
 	}
 
-	return &http.Client{Jar: singleCookieJar(nibitHome, name, value)}, nil
+	return newClient(singleCookieJar(a.home, name, value)), nil
 }
 
 // Parses the session ID cookie of the given response. Returns empty strings
@@ -103,21 +199,26 @@ func (a *nibitScraper) parseSessionCookie(res *http.Response) (name,
 	return match[1], match[2]
 }
 
-// Downloads all available files for the given date.
-func (a *nibitScraper) download(cl *http.Client, date, dir string) error {
+// Returns all available files for the given date.
+func (a *nibitScraper) listDate(ctx context.Context, cl *http.Client,
+	date string) ([]*RemoteFile, error) {
 	// Get homepage.
-	res, err := httpGet(nibitPage, cl)
+	res, err := httpGet(ctx, a.home+nibitPage, cl)
 	if err != nil {
-		return fmt.Errorf("Failed to read page: %v", err)
+		return nil, fmt.Errorf("Failed to read page: %v", err)
 	}
 	if res.StatusCode != http.StatusOK {
 		res.Body.Close()
-		return fmt.Errorf("Failed to read page: Got status %s.", res.Status)
+		return nil, fmt.Errorf("Failed to read page: Got status %s.", res.Status)
 	}
 	body, err := ioutil.ReadAll(res.Body)
 	res.Body.Close()
 	if err != nil {
-		return fmt.Errorf("Failed to read page body: %v", err)
+		return nil, fmt.Errorf("Failed to read page body: %v", err)
+	}
+
+	if a.chain == nibitAllChains {
+		a.reportChains(ctx, body)
 	}
 
 	// Update form values.
@@ -127,18 +228,18 @@ func (a *nibitScraper) download(cl *http.Client, date, dir string) error {
 	a.setFormActionSearch(values)
 
 	// Send post - to get files for specific date and chain.
-	res, err = httpPost(nibitPage, values, cl)
+	res, err = httpPost(ctx, a.home+nibitPage, values, cl)
 	if err != nil {
-		return fmt.Errorf("Failed to read page: %v", err)
+		return nil, fmt.Errorf("Failed to read page: %v", err)
 	}
 	if res.StatusCode != http.StatusOK {
 		res.Body.Close()
-		return fmt.Errorf("Failed to read page: Got status %s.", res.Status)
+		return nil, fmt.Errorf("Failed to read page: Got status %s.", res.Status)
 	}
 	body, err = ioutil.ReadAll(res.Body)
 	res.Body.Close()
 	if err != nil {
-		return fmt.Errorf("Failed to read page body: %v", err)
+		return nil, fmt.Errorf("Failed to read page body: %v", err)
 	}
 
 	a.clearFormAction(values)
@@ -149,76 +250,59 @@ func (a *nibitScraper) download(cl *http.Client, date, dir string) error {
 
 	rows := rowsRe.FindAllSubmatch(body, -1)
 	if len(rows) == 0 {
-		return fmt.Errorf("Found 0 files on page.")
+		return nil, savePage(ctx, res, body,
+			fmt.Errorf("Found 0 files on page."))
 	}
-	log.Printf("Found %d rows (including header).", len(rows))
+	logf(ctx, "Found %d rows (including header).", len(rows))
 	// (There can be days with no files, so no error for 0 files.)
 
-	infos := make(chan *nibitFileInfo, numberOfThreads)
-	done := make(chan error, numberOfThreads)
-
-	// Start pusher thread.
-	go func() {
-		fileNumber := 1
-		// Go over table rows.
-		for _, row := range rows {
-			// Break into columns.
-			cols := colsRe.FindAllSubmatch(row[1], -1)
-			if len(cols) == 0 {
+	// Go over table rows.
+	result := []*RemoteFile{}
+	for _, row := range rows {
+		// Break into columns.
+		cols := colsRe.FindAllSubmatch(row[1], -1)
+		if len(cols) == 0 {
+			continue
+		} // Maybe a header.
+
+		name := string(cols[0][1]) + ".xml.gz"
+		chain := a.chain
+		dir := ""
+		if chain == nibitAllChains {
+			info := filename.Parse(name)
+			if info == nil {
+				logf(ctx, "Skipping '%s', no chain in name.", name)
 				continue
-			} // Maybe a header.
-
-			info := &nibitFileInfo{string(cols[0][1]) + ".xml.gz",
-				fileNumber}
-			fileNumber++
-
-			infos <- info
-		}
-
-		close(infos)
-	}()
-
-	// Start downloader threads.
-	for i := 0; i < numberOfThreads; i++ {
-		go func() {
-			for info := range infos {
-				_, err := downloadIfNotExists(
-					nibitDownload+a.chain+"/"+info.name,
-					filepath.Join(dir, info.name), cl)
-				if err != nil {
-					done <- fmt.Errorf("Failed to download '%s': %v",
-						info.name, err)
-					return
-				}
 			}
-
-			done <- nil
-		}()
-	}
-
-	// Wait for downloaders.
-	for i := 0; i < numberOfThreads; i++ {
-		e := <-done
-		if e != nil {
-			err = e
+			chain = info.Chain
+			dir = chain + "/"
 		}
+		result = append(result, &RemoteFile{Name: dir + name,
+			URL: a.home + nibitDownload + chain + "/" + name})
 	}
 
-	// Drain pusher thread.
-	for range infos {
-	}
-
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return filterFiles(ctx, result), nil
 }
 
-// Information needed to download a file.
-type nibitFileInfo struct {
-	name   string // Name by which to save on disk.
-	target int    // Event to send to server.
+// Logs the chains in the form's chain list that are not known, unless they
+// were reported before.
+func (a *nibitScraper) reportChains(ctx context.Context, body []byte) {
+	list := find(body, "(?s)<select name=\"ctl00\\$MainContent\\$chain\""+
+		".*?>(.*?)</select>")
+	options := regexp.MustCompile("<option[^>]* value=\"(\\d+)\"").
+		FindAllSubmatch(list, -1)
+	var unknown []string
+	for _, option := range options {
+		chain := string(option[1])
+		if !a.known[chain] {
+			unknown = append(unknown, chain)
+			a.known[chain] = true
+		}
+	}
+	if len(unknown) > 0 {
+		logf(ctx, "Found chains that are not configured: %s",
+			strings.Join(unknown, ", "))
+	}
 }
 
 // Parses form values from the given response body. Before using the result for
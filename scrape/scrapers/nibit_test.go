@@ -0,0 +1,131 @@
+package scrapers
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Returns a fake Nibit site that answers queries for the given chain with
+// the given results page.
+func newFakeNibit(t *testing.T, a *nibitScraper, chain,
+	results string) *fakeSite {
+	s := newFakeSite(t)
+	a.home = s.home()
+	s.handle("/NBCompetitionRegulations.aspx", func(w http.ResponseWriter,
+		r *http.Request) {
+		if r.Method == "HEAD" {
+			w.Header().Add("Set-Cookie",
+				"ASP.NET_SessionId=fake-session; path=/; HttpOnly")
+			return
+		}
+		if c, err := r.Cookie("ASP.NET_SessionId"); err != nil ||
+			c.Value != "fake-session" {
+			http.Error(w, "No session", http.StatusForbidden)
+			return
+		}
+		if r.Method == "GET" {
+			s.writePage(w, "nibit/form.html")
+			return
+		}
+		date := a.formatDate(time.Now())
+		if r.FormValue("__VIEWSTATE") != "fake-view-state" ||
+			r.FormValue("ctl00$MainContent$chain") != chain ||
+			r.FormValue("ctl00$MainContent$txtDate") != date ||
+			r.FormValue("ctl00$MainContent$btnSearch") == "" {
+			http.Error(w, "Bad form", http.StatusBadRequest)
+			return
+		}
+		s.writePage(w, results)
+	})
+	return s
+}
+
+func TestNibit(t *testing.T) {
+	a := &nibitScraper{chain: Victory, days: 1}
+	s := newFakeNibit(t, a, Victory, "nibit/results.html")
+	s.files("/CompetitionRegulationsFiles/latest/" + Victory + "/")
+
+	checkScrape(t, a,
+		"Price7290696200003-001-202610170300.xml.gz",
+		"PromoFull7290696200003-001-202610170300.xml.gz",
+		"Stores7290696200003-202610170100.xml.gz",
+	)
+}
+
+func TestNibitAll(t *testing.T) {
+	a := NibitAll(1, []string{Victory, Hashook, Lahav}).(*nibitScraper)
+	s := newFakeNibit(t, a, nibitAllChains, "nibit/results_all.html")
+	s.files("/CompetitionRegulationsFiles/latest/")
+
+	files, err := a.List(context.Background())
+	if err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name)
+		if file.URL != s.home()+nibitDownload+path.Base(path.Dir(file.Name))+
+			"/"+path.Base(file.Name) {
+			t.Errorf("List() returned URL %s for %s", file.URL, file.Name)
+		}
+	}
+	checkNames(t, "List()", names, []string{
+		Victory + "/Price7290696200003-001-202610170300.xml.gz",
+		Victory + "/PromoFull7290696200003-001-202610170300.xml.gz",
+		Victory + "/Stores7290696200003-202610170100.xml.gz",
+		"7290000000031/PriceFull7290000000031-005-202610170300.xml.gz",
+	})
+	if !a.known["7290000000031"] {
+		t.Errorf("List() did not report chain 7290000000031")
+	}
+
+	dir := t.TempDir()
+	if err := a.Scrape(context.Background(), dir); err != nil {
+		t.Fatalf("Scrape(...) failed: %v", err)
+	}
+	name := "PriceFull7290000000031-005-202610170300.xml.gz"
+	data, _ := ioutil.ReadFile(filepath.Join(dir, "7290000000031", name))
+	if string(data) != fakeData(name) {
+		t.Errorf("Scrape(...) saved %q in %s, want %q", data, name,
+			fakeData(name))
+	}
+}
+
+func TestNibitDates(t *testing.T) {
+	defer func(from, to int64) {
+		fromTimestamp, toTimestamp = from, to
+	}(fromTimestamp, toTimestamp)
+
+	tests := []struct {
+		days     int
+		from, to string
+		want     []string
+	}{
+		{2, "", "202610072359", []string{"07/10/2026", "06/10/2026"}},
+		{1, "202610010000", "202610031200",
+			[]string{"03/10/2026", "02/10/2026", "01/10/2026"}},
+		{7, "202610050000", "202610050000", []string{"05/10/2026"}},
+		{1, "", "202610070100", []string{"07/10/2026"}}, // 6/10 in UTC.
+	}
+	for i, test := range tests {
+		fromTimestamp, toTimestamp = -1, -1
+		if test.from != "" {
+			SetFromTimestamp(test.from)
+		}
+		SetToTimestamp(test.to)
+		a := &nibitScraper{days: test.days}
+		var got []string
+		for _, day := range a.dates() {
+			got = append(got, a.formatDate(day))
+		}
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("#%v: dates()=%v want %v", i+1, got, test.want)
+		}
+	}
+}
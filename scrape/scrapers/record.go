@@ -0,0 +1,94 @@
+package scrapers
+
+// Recording of handled files in the run's manifest.
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fluhus/prices/scrape/manifest"
+)
+
+// manifestWriter receives an entry for every file that scrapers download or
+// skip. Nil if no manifest is kept.
+var manifestWriter *manifest.Writer
+
+// SetManifest makes all scrapers record the files they download or skip in
+// the given manifest. Give nil to stop recording.
+func SetManifest(w *manifest.Writer) {
+	manifestWriter = w
+}
+
+// knownFiles holds the last checksum of every file, by absolute path. Files
+// that are skipped and did not change since are not hashed again.
+var (
+	knownFiles      = map[string]*manifest.Entry{}
+	knownFilesMutex sync.Mutex
+)
+
+// SetKnownFiles sets the checksums of files from previous runs, by absolute
+// path, as returned by manifest.Latest.
+func SetKnownFiles(entries map[string]*manifest.Entry) {
+	knownFilesMutex.Lock()
+	defer knownFilesMutex.Unlock()
+	knownFiles = map[string]*manifest.Entry{}
+	for path, e := range entries {
+		knownFiles[path] = e
+	}
+}
+
+// record completes the given entry and adds it to the manifest. Err is the
+// download's error, or nil if the file is in place.
+func record(ctx context.Context, e *manifest.Entry, err error) {
+	if manifestWriter == nil {
+		return
+	}
+	e.Chain = chainOf(ctx)
+	if err != nil {
+		e.Error = err.Error()
+	} else {
+		err = hashEntry(e)
+		if err != nil {
+			e.Error = err.Error()
+		}
+	}
+	err = manifestWriter.Add(e)
+	if err != nil {
+		logf(ctx, "Failed to write manifest entry for '%s': %v", e.Path, err)
+	}
+}
+
+// Sets the entry's checksum, size and modification time. A skipped file
+// reuses its known checksum if its size and modification time did not change.
+func hashEntry(e *manifest.Entry) error {
+	path, err := filepath.Abs(e.Path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	knownFilesMutex.Lock()
+	known := knownFiles[path]
+	knownFilesMutex.Unlock()
+	if e.Skipped && known != nil && known.SHA256 != "" &&
+		known.Size == info.Size() && known.ModTime.Equal(info.ModTime()) {
+		e.SHA256, e.Size, e.ModTime = known.SHA256, known.Size, known.ModTime
+		return nil
+	}
+
+	e.SHA256, e.Size, err = manifest.HashFile(path)
+	if err != nil {
+		return err
+	}
+	e.ModTime = info.ModTime()
+	ee := *e
+	knownFilesMutex.Lock()
+	knownFiles[path] = &ee
+	knownFilesMutex.Unlock()
+	return nil
+}
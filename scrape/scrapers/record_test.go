@@ -0,0 +1,60 @@
+package scrapers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fluhus/prices/scrape/manifest"
+)
+
+func TestHashEntry(t *testing.T) {
+	defer SetKnownFiles(nil)
+	path := filepath.Join(t.TempDir(), "Price1.gz")
+	if err := ioutil.WriteFile(path, []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A fake checksum, to tell whether the file was hashed.
+	SetKnownFiles(map[string]*manifest.Entry{path: {Path: path, Size: 5,
+		SHA256: "known", ModTime: info.ModTime()}})
+
+	e := &manifest.Entry{Path: path, Skipped: true}
+	if err := hashEntry(e); err != nil {
+		t.Fatal(err)
+	}
+	if e.SHA256 != "known" {
+		t.Errorf("hashEntry(unchanged) SHA256=%q want %q", e.SHA256, "known")
+	}
+
+	// A downloaded file is always hashed.
+	e = &manifest.Entry{Path: path}
+	if err := hashEntry(e); err != nil {
+		t.Fatal(err)
+	}
+	want, _, _ := manifest.HashFile(path)
+	if e.SHA256 != want {
+		t.Errorf("hashEntry(downloaded) SHA256=%q want %q", e.SHA256, want)
+	}
+
+	// A changed file is hashed again.
+	SetKnownFiles(map[string]*manifest.Entry{path: {Path: path, Size: 5,
+		SHA256: "known", ModTime: info.ModTime()}})
+	later := info.ModTime().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	e = &manifest.Entry{Path: path, Skipped: true}
+	if err := hashEntry(e); err != nil {
+		t.Fatal(err)
+	}
+	if e.SHA256 != want || !e.ModTime.Equal(later) {
+		t.Errorf("hashEntry(changed)=%q,%v want %q,%v", e.SHA256, e.ModTime,
+			want, later)
+	}
+}
@@ -0,0 +1,217 @@
+package scrapers
+
+// Retrying of failed downloads.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// A RetryClass is a set of failure kinds that are worth retrying.
+type RetryClass int
+
+// Failure kinds that can be retried. Combine with '|'.
+const (
+	RetryServerError     RetryClass = 1 << iota // 5xx response status.
+	RetryTooManyRequests                        // 429 response status.
+	RetryTimeout                                // Request timed out.
+	RetryConnReset                              // Connection was reset or cut.
+
+	RetryAll = RetryServerError | RetryTooManyRequests | RetryTimeout |
+		RetryConnReset
+)
+
+// Names of retry classes, as given on the command line.
+var retryClassNames = map[string]RetryClass{
+	"5xx":     RetryServerError,
+	"429":     RetryTooManyRequests,
+	"timeout": RetryTimeout,
+	"reset":   RetryConnReset,
+}
+
+// ParseRetryClass parses a comma separated list of retry class names:
+// 5xx, 429, timeout and reset. An empty string means no class.
+func ParseRetryClass(s string) (RetryClass, error) {
+	var result RetryClass
+	if s == "" {
+		return result, nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		c, ok := retryClassNames[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown retry class: %q", name)
+		}
+		result |= c
+	}
+	return result, nil
+}
+
+// A RetryPolicy determines how failed downloads are retried.
+type RetryPolicy struct {
+	Attempts   int           // Total number of attempts, including the first.
+	MinBackoff time.Duration // Wait before the first retry.
+	MaxBackoff time.Duration // Maximal wait between attempts.
+	Classes    RetryClass    // Which failures to retry.
+}
+
+// DefaultRetryPolicy is the policy used unless SetRetryPolicy is called.
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   4,
+	MinBackoff: time.Second,
+	MaxBackoff: time.Minute,
+	Classes:    RetryAll,
+}
+
+// retryPolicy is the policy used by all downloads.
+var retryPolicy = DefaultRetryPolicy
+
+// SetRetryPolicy sets the policy by which failed downloads are retried.
+func SetRetryPolicy(p RetryPolicy) error {
+	if p.Attempts < 1 {
+		return fmt.Errorf("bad number of attempts: %d, must be positive",
+			p.Attempts)
+	}
+	if p.MinBackoff < 0 || p.MaxBackoff < p.MinBackoff {
+		return fmt.Errorf("bad backoff range: %v-%v", p.MinBackoff,
+			p.MaxBackoff)
+	}
+	retryPolicy = p
+	return nil
+}
+
+// A statusError reports an unexpected response status.
+type statusError struct {
+	code       int           // Response status code.
+	status     string        // Response status text.
+	retryAfter time.Duration // Wait requested by the server, or 0.
+}
+
+// Returns a status error for the given response.
+func newStatusError(res *http.Response) *statusError {
+	return &statusError{res.StatusCode, res.Status, parseRetryAfter(res)}
+}
+
+func (e *statusError) Error() string {
+	return "Got bad response status: " + e.status
+}
+
+// Parses the Retry-After header of a response, in either of its forms.
+// Returns 0 if absent or malformed.
+func parseRetryAfter(res *http.Response) time.Duration {
+	field := res.Header.Get("Retry-After")
+	if field == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(field); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(field); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// Returns the class of the given error, or 0 if it should not be retried.
+func retryClassOf(err error) RetryClass {
+	var serr *statusError
+	if errors.As(err, &serr) {
+		switch {
+		case serr.code == http.StatusTooManyRequests:
+			return RetryTooManyRequests
+		case serr.code >= 500:
+			return RetryServerError
+		default:
+			return 0
+		}
+	}
+
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return RetryTimeout
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF) {
+		return RetryConnReset
+	}
+
+	return 0
+}
+
+// withRetry calls f until it succeeds, the error is not retryable, or the
+// attempts of the retry policy run out. A Retry-After that is longer than the
+// policy's maximal backoff also stops the retries. Each failed attempt is
+// logged with the given description. Returns the last error.
+func withRetry(ctx context.Context, what string, f func() error) error {
+	p := retryPolicy
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = f()
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		if retryClassOf(err)&p.Classes == 0 || attempt >= p.Attempts {
+			if attempt > 1 {
+				logf(ctx, "Attempt %d/%d for %s failed: %v. Giving up.",
+					attempt, p.Attempts, what, err)
+			}
+			return err
+		}
+
+		// A server that asks for a longer wait than the policy allows is not
+		// retried sooner than it asked.
+		wait := backoff(p, attempt)
+		var serr *statusError
+		if errors.As(err, &serr) && serr.retryAfter > wait {
+			if serr.retryAfter > p.MaxBackoff {
+				logf(ctx, "Attempt %d/%d for %s failed: %v. Server asked to "+
+					"wait %v, more than %v. Giving up.", attempt, p.Attempts,
+					what, err, serr.retryAfter, p.MaxBackoff)
+				return err
+			}
+			wait = serr.retryAfter
+		}
+		logf(ctx, "Attempt %d/%d for %s failed: %v. Retrying in %v.",
+			attempt, p.Attempts, what, err, wait.Round(time.Millisecond))
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// Returns the wait before the given retry, doubling per attempt with a
+// random jitter of up to half of the wait.
+func backoff(p RetryPolicy, attempt int) time.Duration {
+	d := p.MinBackoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
@@ -0,0 +1,114 @@
+package scrapers
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFetchFileRetries(t *testing.T) {
+	defer func(p RetryPolicy) { retryPolicy = p }(retryPolicy)
+	retryPolicy = RetryPolicy{3, time.Millisecond, time.Millisecond, RetryAll}
+
+	tests := []struct {
+		statuses []int
+		wantErr  bool
+		wantHits int
+	}{
+		{[]int{200}, false, 1},
+		{[]int{503, 429, 200}, false, 3},
+		{[]int{503, 503, 503, 200}, true, 3},
+		{[]int{404, 200}, true, 1},
+	}
+	for i, test := range tests {
+		hits := 0
+		srv := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.statuses[hits])
+				w.Write([]byte("data"))
+				hits++
+			}))
+		to := filepath.Join(t.TempDir(), "file")
+		_, err := fetchFile(context.Background(), srv.URL, to, nil,
+			func() (*http.Request, error) {
+				return http.NewRequest("GET", srv.URL, nil)
+			})
+		srv.Close()
+
+		if (err != nil) != test.wantErr {
+			t.Errorf("#%v: fetchFile(...) error=%v want error=%v",
+				i+1, err, test.wantErr)
+		}
+		if hits != test.wantHits {
+			t.Errorf("#%v: fetchFile(...) made %v requests want %v",
+				i+1, hits, test.wantHits)
+		}
+		if err == nil {
+			if data, _ := ioutil.ReadFile(to); string(data) != "data" {
+				t.Errorf("#%v: fetchFile(...) saved %q want %q",
+					i+1, data, "data")
+			}
+		} else if fileExists(to) {
+			t.Errorf("#%v: fetchFile(...) left a file behind", i+1)
+		}
+	}
+}
+
+func TestRetryAfterLimit(t *testing.T) {
+	defer func(p RetryPolicy) { retryPolicy = p }(retryPolicy)
+	retryPolicy = RetryPolicy{3, time.Millisecond, time.Second, RetryAll}
+
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			hits++
+			w.Header().Set("Retry-After", "86400")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+	defer srv.Close()
+
+	start := time.Now()
+	err := withRetry(context.Background(), "test", func() error {
+		res, err := httpGet(context.Background(), srv.URL, nil)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		return newStatusError(res)
+	})
+	if err == nil || hits != 1 {
+		t.Errorf("withRetry(...) error=%v after %d requests, want error "+
+			"after 1", err, hits)
+	}
+	if d := time.Since(start); d > retryPolicy.MaxBackoff {
+		t.Errorf("withRetry(...) took %v, want at most %v", d,
+			retryPolicy.MaxBackoff)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		field string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"-5", 0},
+		{"soon", 0},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0},
+	}
+	for i, test := range tests {
+		res := &http.Response{Header: http.Header{}}
+		if test.field != "" {
+			res.Header.Set("Retry-After", test.field)
+		}
+		if got := parseRetryAfter(res); got != test.want {
+			t.Errorf("#%v: parseRetryAfter(%q)=%v want %v",
+				i+1, test.field, got, test.want)
+		}
+	}
+}
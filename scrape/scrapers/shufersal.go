@@ -3,47 +3,65 @@ package scrapers
 // A scraper for the Shufersal chain.
 
 import (
+	"context"
 	"fmt"
 	"html"
 	"io/ioutil"
-	"log"
 	"net/http"
-	"path/filepath"
 	"regexp"
 	"strconv"
+	"sync"
 )
 
+// Home page of the Shufersal price site.
+const shufersalHome = "http://prices.shufersal.co.il/"
+
 // A scraper for the Shufersal chain.
-type shufersalScraper struct{}
+type shufersalScraper struct {
+	home string // Site's homepage, normally shufersalHome.
+}
 
 // Returns a new Shufersal scraper.
 func Shufersal() Scraper {
-	return &shufersalScraper{}
+	return &shufersalScraper{shufersalHome}
+}
+
+func (a *shufersalScraper) Scrape(ctx context.Context, dir string) error {
+	files, err := a.List(ctx)
+	if err != nil {
+		return err
+	}
+	return downloadFiles(ctx, dir, files, nil)
 }
 
-func (a *shufersalScraper) Scrape(dir string) error {
+func (a *shufersalScraper) List(ctx context.Context) ([]*RemoteFile, error) {
+	threads := threadsOf(ctx)
+
 	// Get number of pages from the first page.
-	page, err := a.getPage(1)
+	res, page, err := a.getPage(ctx, 1)
 	if err != nil {
-		return fmt.Errorf("Failed to get page 1: %v", err)
+		return nil, fmt.Errorf("Failed to get page 1: %v", err)
 	}
 
 	numberOfPages := a.parseLastPageNumber(page)
 	if numberOfPages == -1 {
-		return fmt.Errorf("Failed to parse number of pages.")
+		return nil, savePage(ctx, res, page,
+			fmt.Errorf("Failed to parse number of pages."))
 	}
-	log.Printf("Parsing %d pages.", numberOfPages)
+	logf(ctx, "Parsing %d pages.", numberOfPages)
 
-	// Download!
-	numChan := make(chan int, numberOfThreads)
-	done := make(chan error, numberOfThreads)
+	// Parse pages.
+	numChan := make(chan int, threads)
+	done := make(chan error, threads)
+	var files []*RemoteFile
+	var filesLock sync.Mutex
 
-	for i := 0; i < numberOfThreads; i++ {
+	for i := 0; i < threads; i++ {
 		go func() {
 			for i := range numChan {
 				// Parse page.
-				log.Printf("Parsing page %d.", i)
-				page, err := a.getPage(i)
+				logf(ctx, "Parsing page %d.", i)
+				res, page, err := a.getPage(ctx, i)
 				if err != nil {
 					done <- err
 					return
@@ -51,20 +69,17 @@ func (a *shufersalScraper) Scrape(dir string) error {
 
 				entries, err := a.parsePage(page)
 				if err != nil {
-					done <- err
+					done <- savePage(ctx, res, page, err)
 					return
 				}
-				log.Printf("Page %d has %d entries.", i, len(entries))
+				logf(ctx, "Page %d has %d entries.", i, len(entries))
 
-				// Download entries.
+				filesLock.Lock()
 				for _, entry := range entries {
-					to := filepath.Join(dir, entry.file)
-					_, err := downloadIfNotExists(entry.url, to, nil)
-					if err != nil {
-						done <- err
-						return
-					}
+					files = append(files, &RemoteFile{Name: entry.file,
+						URL: entry.url})
 				}
+				filesLock.Unlock()
 			}
 
 			done <- nil
@@ -80,7 +95,7 @@ func (a *shufersalScraper) Scrape(dir string) error {
 	}()
 
 	// Join threads.
-	for i := 0; i < numberOfThreads; i++ {
+	for i := 0; i < threads; i++ {
 		e := <-done
 		if e != nil {
 			err = e
@@ -91,22 +106,30 @@ func (a *shufersalScraper) Scrape(dir string) error {
 	for range numChan {
 	}
 
-	return err
+	if err != nil {
+		return nil, err
+	}
+
+	return filterFiles(ctx, files), nil
 }
 
-// Returns the body of the n'th page in Shufersal's site.
-func (a *shufersalScraper) getPage(n int) ([]byte, error) {
-	res, err := httpGet(fmt.Sprintf("http://prices.shufersal.co.il/?page=%d",
-		n), nil)
+// Returns the n'th page in Shufersal's site, with the response it came in.
+func (a *shufersalScraper) getPage(ctx context.Context, n int) (
+	*http.Response, []byte, error) {
+	res, err := httpGet(ctx, fmt.Sprintf("%s?page=%d", a.home, n), nil)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Bad response status: %s", res.Status)
+		return nil, nil, fmt.Errorf("Bad response status: %s", res.Status)
 	}
 
-	return ioutil.ReadAll(res.Body)
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, body, nil
 }
 
 // A single downloadable file.
@@ -0,0 +1,32 @@
+package scrapers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestShufersal(t *testing.T) {
+	s := newFakeSite(t)
+	s.handle("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		switch r.FormValue("page") {
+		case "1":
+			s.writePage(w, "shufersal/page1.html")
+		case "2":
+			s.writePage(w, "shufersal/page2.html")
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	s.files("/price/")
+	s.files("/pricefull/")
+	s.files("/promo/")
+	checkScrape(t, &shufersalScraper{s.home()},
+		"Price7290027600007-001-202610170300.gz",
+		"PriceFull7290027600007-001-202610170300.gz",
+		"Promo7290027600007-002-202610170300.gz",
+	)
+}
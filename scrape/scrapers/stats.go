@@ -0,0 +1,133 @@
+package scrapers
+
+// Counting of scraper work, for run summaries.
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Stats counts the files a scraper handled in a run. Safe for concurrent use.
+type Stats struct {
+	mutex      sync.Mutex
+	listed     int
+	downloaded int
+	skipped    int
+	failed     int
+	bytes      int64
+	errors     map[string]int
+}
+
+// StatsSnapshot is a copy of the counts of a Stats object.
+type StatsSnapshot struct {
+	Listed     int            `json:"listed"`     // Files found on the site.
+	Downloaded int            `json:"downloaded"` // Files downloaded.
+	Skipped    int            `json:"skipped"`    // Files already present.
+	Failed     int            `json:"failed"`     // Files that failed.
+	Bytes      int64          `json:"bytes"`      // Bytes downloaded.
+	Errors     map[string]int `json:"errors"`     // Failures per error class.
+}
+
+// statsKey is the context key for the stats of the chain being scraped.
+type statsKey struct{}
+
+// WithStats returns a context that makes scrapers running under it count
+// their work in s.
+func WithStats(ctx context.Context, s *Stats) context.Context {
+	return context.WithValue(ctx, statsKey{}, s)
+}
+
+// Returns the stats given to WithStats. The result may be nil, and its
+// methods are safe to call on nil.
+func statsOf(ctx context.Context) *Stats {
+	s, _ := ctx.Value(statsKey{}).(*Stats)
+	return s
+}
+
+// Snapshot returns a copy of the current counts.
+func (s *Stats) Snapshot() StatsSnapshot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	errs := map[string]int{}
+	for class, n := range s.errors {
+		errs[class] = n
+	}
+	return StatsSnapshot{s.listed, s.downloaded, s.skipped, s.failed,
+		s.bytes, errs}
+}
+
+// Counts a file that was found on the site.
+func (s *Stats) addListed() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.listed++
+}
+
+// Counts a file that was already present.
+func (s *Stats) addSkipped() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.skipped++
+}
+
+// Counts a downloaded file of the given size.
+func (s *Stats) addDownloaded(size int64) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.downloaded++
+	if size > 0 {
+		s.bytes += size
+	}
+}
+
+// Counts a file that failed with the given error.
+func (s *Stats) addFailed(err error) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failed++
+	if s.errors == nil {
+		s.errors = map[string]int{}
+	}
+	s.errors[ErrorClass(err)]++
+}
+
+// ErrorClass returns a short name for the kind of the given error: one of the
+// retry class names (5xx, 429, timeout, reset), "status" for other bad
+// response statuses, "invalid" for files that failed validation, "canceled",
+// or "other".
+func ErrorClass(err error) string {
+	if isInvalidFile(err) {
+		return "invalid"
+	}
+	switch retryClassOf(err) {
+	case RetryServerError:
+		return "5xx"
+	case RetryTooManyRequests:
+		return "429"
+	case RetryTimeout:
+		return "timeout"
+	case RetryConnReset:
+		return "reset"
+	}
+	var serr *statusError
+	if errors.As(err, &serr) {
+		return "status"
+	}
+	if errors.Is(err, context.Canceled) {
+		return "canceled"
+	}
+	return "other"
+}
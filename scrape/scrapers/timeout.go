@@ -0,0 +1,201 @@
+package scrapers
+
+// Timeouts of HTTP requests.
+//
+// A request is not bounded as a whole, so that large files on slow servers can
+// take as long as they need. Instead, each stage of a request is bounded:
+// getting a connection, waiting for the response headers, and waiting between
+// reads of the body. A watchdog cancels the request when a stage takes too
+// long, so transfers that are still moving finish and stalled ones do not.
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Timeouts bound the stages of HTTP requests. Zero means no limit.
+type Timeouts struct {
+	Connect time.Duration // Getting a connection, including DNS and TLS.
+	Header  time.Duration // From sending the request to the response headers.
+	Idle    time.Duration // Between reads of the response body.
+}
+
+// DefaultTimeouts are the timeouts of chains that have no specific timeouts.
+var DefaultTimeouts = Timeouts{Connect: 10 * time.Second,
+	Header: 30 * time.Second, Idle: 30 * time.Second}
+
+// Timeouts of chains that have no specific timeouts.
+var defaultTimeouts = DefaultTimeouts
+
+// SetTimeouts sets the timeouts of chains that have no specific timeouts.
+// Should be called before scraping starts.
+func SetTimeouts(t Timeouts) error {
+	if err := t.check(); err != nil {
+		return err
+	}
+	defaultTimeouts = t
+	return nil
+}
+
+// ParseTimeouts parses timeouts from a connect/header/idle string, e.g.
+// "10s/30s/1m". Empty parts keep the values given to SetTimeouts.
+func ParseTimeouts(s string) (Timeouts, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 3 {
+		return Timeouts{}, fmt.Errorf("bad timeouts: %q, expected %q", s,
+			"connect/header/idle")
+	}
+	result := defaultTimeouts
+	values := []*time.Duration{&result.Connect, &result.Header, &result.Idle}
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		d, err := time.ParseDuration(part)
+		if err != nil {
+			return Timeouts{}, fmt.Errorf("bad timeouts: %q: %v", s, err)
+		}
+		*values[i] = d
+	}
+	if err := result.check(); err != nil {
+		return Timeouts{}, err
+	}
+	return result, nil
+}
+
+// Checks that the timeouts are valid.
+func (t Timeouts) check() error {
+	if t.Connect < 0 || t.Header < 0 || t.Idle < 0 {
+		return fmt.Errorf("bad timeouts: %+v, values must be non-negative", t)
+	}
+	return nil
+}
+
+// timeoutsKey is the context key for the timeouts of a chain.
+type timeoutsKey struct{}
+
+// WithTimeouts returns a context that makes requests under it use the given
+// timeouts instead of the ones given to SetTimeouts.
+func WithTimeouts(ctx context.Context, t Timeouts) context.Context {
+	return context.WithValue(ctx, timeoutsKey{}, t)
+}
+
+// Returns the timeouts of requests under ctx.
+func timeoutsOf(ctx context.Context) Timeouts {
+	if t, ok := ctx.Value(timeoutsKey{}).(Timeouts); ok {
+		return t
+	}
+	return defaultTimeouts
+}
+
+// A timeoutError reports a stage of a request that took too long.
+type timeoutError struct {
+	stage string        // What the request was doing.
+	limit time.Duration // The stage's timeout.
+}
+
+func (e *timeoutError) Error() string {
+	return fmt.Sprintf("Timed out %s after %v.", e.stage, e.limit)
+}
+
+// Timeout makes the error count as a timeout for retries.
+func (e *timeoutError) Timeout() bool { return true }
+
+// Temporary is part of the net.Error interface.
+func (e *timeoutError) Temporary() bool { return true }
+
+// A watchdog cancels a request when its current stage takes longer than the
+// stage's timeout.
+type watchdog struct {
+	cancel context.CancelFunc // Cancels the request.
+	timer  *time.Timer        // Nil if the stage has no limit.
+	stage  int                // Counts stages, so old timers do nothing.
+	fired  *timeoutError      // Non-nil after the request was canceled.
+	mutex  sync.Mutex
+}
+
+// Starts a watchdog that cancels the request with the given function, and
+// returns a context that tells the watchdog when the request's stages start.
+func newWatchdog(ctx context.Context, t Timeouts,
+	cancel context.CancelFunc) (*watchdog, context.Context) {
+	w := &watchdog{cancel: cancel}
+	w.start("connecting", t.Connect)
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(string) {
+			w.start("connecting", t.Connect)
+		},
+		GotConn: func(httptrace.GotConnInfo) {
+			w.start("waiting for response", t.Header)
+		},
+	})
+	return w, ctx
+}
+
+// Starts a stage with the given name and timeout, ending the current one. A
+// zero timeout means no limit.
+func (w *watchdog) start(stage string, limit time.Duration) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.fired != nil {
+		return
+	}
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.stage++
+	if limit <= 0 {
+		return
+	}
+	n := w.stage
+	w.timer = time.AfterFunc(limit, func() {
+		w.mutex.Lock()
+		if w.stage != n || w.fired != nil {
+			w.mutex.Unlock()
+			return
+		}
+		w.fired = &timeoutError{stage, limit}
+		w.mutex.Unlock()
+		w.cancel()
+	})
+}
+
+// Stops the watchdog without canceling the request.
+func (w *watchdog) stop() {
+	w.start("", 0)
+}
+
+// Returns the timeout that canceled the request if the watchdog fired, or err
+// otherwise.
+func (w *watchdog) err(err error) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.fired != nil {
+		return w.fired
+	}
+	return err
+}
+
+// An idleBody is a response body whose watchdog allows a limited time between
+// reads.
+type idleBody struct {
+	io.ReadCloser
+	w     *watchdog
+	limit time.Duration
+}
+
+func (b *idleBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		return n, b.w.err(err)
+	}
+	if n > 0 {
+		b.w.start("reading response", b.limit)
+	}
+	return n, err
+}
@@ -0,0 +1,93 @@
+package scrapers
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTimeouts(t *testing.T) {
+	const chunks = 6
+	tests := []struct {
+		delay     time.Duration // Before the headers.
+		interval  time.Duration // Between chunks of the body.
+		wantClass string        // Error class, empty for success.
+	}{
+		// Takes longer than every timeout, but keeps moving.
+		{0, 30 * time.Millisecond, ""},
+		{200 * time.Millisecond, 0, "timeout"},
+		{0, 200 * time.Millisecond, "timeout"},
+	}
+	for i, test := range tests {
+		srv := httptest.NewServer(http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(test.delay)
+				w.WriteHeader(http.StatusOK)
+				for j := 0; j < chunks; j++ {
+					w.Write([]byte("data"))
+					w.(http.Flusher).Flush()
+					select {
+					case <-time.After(test.interval):
+					case <-r.Context().Done():
+						return
+					}
+				}
+			}))
+
+		ctx := WithTimeouts(context.Background(), Timeouts{
+			Connect: time.Second, Header: 100 * time.Millisecond,
+			Idle: 100 * time.Millisecond})
+		var body []byte
+		res, err := httpGet(ctx, srv.URL, nil)
+		if err == nil {
+			body, err = ioutil.ReadAll(res.Body)
+			res.Body.Close()
+		}
+		srv.Close()
+
+		if test.wantClass == "" {
+			if err != nil {
+				t.Errorf("#%v: httpGet(...) failed: %v", i+1, err)
+			} else if len(body) != 4*chunks {
+				t.Errorf("#%v: httpGet(...) read %d bytes, want %d", i+1,
+					len(body), 4*chunks)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("#%v: httpGet(...) succeeded, want error", i+1)
+		} else if got := ErrorClass(err); got != test.wantClass {
+			t.Errorf("#%v: httpGet(...) error=%v class=%q, want %q", i+1,
+				err, got, test.wantClass)
+		}
+	}
+}
+
+func TestParseTimeouts(t *testing.T) {
+	defer func(t Timeouts) { defaultTimeouts = t }(defaultTimeouts)
+	defaultTimeouts = Timeouts{1, 2, 3}
+
+	tests := []struct {
+		s       string
+		want    Timeouts
+		wantErr bool
+	}{
+		{"10s/30s/1m", Timeouts{10 * time.Second, 30 * time.Second,
+			time.Minute}, false},
+		{"//0", Timeouts{1, 2, 0}, false},
+		{"5s//", Timeouts{5 * time.Second, 2, 3}, false},
+		{"10s/30s", Timeouts{}, true},
+		{"10s/x/1m", Timeouts{}, true},
+		{"10s/-1s/1m", Timeouts{}, true},
+	}
+	for i, test := range tests {
+		got, err := ParseTimeouts(test.s)
+		if (err != nil) != test.wantErr || err == nil && got != test.want {
+			t.Errorf("#%v: ParseTimeouts(%q)=%v,%v want %v,%v", i+1, test.s,
+				got, err, test.want, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package scrapers
+
+// Validation of downloaded files.
+//
+// Some sites answer with error pages or with truncated files, while reporting
+// success. When validation is on, every downloaded file is checked before it
+// is accepted: it must have a minimal size, archives must be intact, and the
+// data in them must look like XML with a root element. Files that fail are
+// moved to a quarantine directory, next to a file with the reason.
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Validation configures the checks of downloaded files.
+type Validation struct {
+	MinSize    int64  // Minimal size of a downloaded file, in bytes.
+	Quarantine string // Where to move invalid files. Empty means delete them.
+}
+
+// Validation settings, nil if validation is off.
+var validation *Validation
+
+// SetValidation turns on validation of downloaded files with the given
+// settings. Should be called before scraping starts.
+func SetValidation(v Validation) error {
+	if v.MinSize < 0 {
+		return fmt.Errorf("bad minimal size: %d, must be non-negative",
+			v.MinSize)
+	}
+	validation = &v
+	return nil
+}
+
+// invalidFileError reports a downloaded file that failed validation.
+type invalidFileError struct {
+	reason string
+}
+
+func (e *invalidFileError) Error() string {
+	return "Invalid file: " + e.reason
+}
+
+// Returns an invalidFileError with the given reason.
+func invalidf(format string, a ...interface{}) error {
+	return &invalidFileError{fmt.Sprintf(format, a...)}
+}
+
+// Returns true if the error is of a file that failed validation.
+func isInvalidFile(err error) bool {
+	var ierr *invalidFileError
+	return errors.As(err, &ierr)
+}
+
+// Checks the downloaded partial file at the given path before it is renamed to
+// its final path, if validation is on, so that final files are always valid. A
+// file that fails is moved to the quarantine directory under its final name,
+// and an invalidFileError is returned.
+func acceptFile(ctx context.Context, path, final string) error {
+	if validation == nil {
+		return nil
+	}
+	err := validateFile(path, validation.MinSize)
+	if err == nil || !isInvalidFile(err) {
+		return err
+	}
+
+	if validation.Quarantine == "" {
+		os.Remove(path)
+		logf(ctx, "Removed '%s': %v", path, err)
+		return err
+	}
+	chain := chainOf(ctx)
+	if chain == "" {
+		chain = "unknown"
+	}
+	to := filepath.Join(validation.Quarantine, chain, filepath.Base(final))
+	if qerr := quarantine(path, to, err); qerr != nil {
+		logf(ctx, "Failed to quarantine '%s': %v", path, qerr)
+		os.Remove(path)
+		return err
+	}
+	logf(ctx, "Quarantined '%s' to '%s': %v", path, to, err)
+	return err
+}
+
+// QuarantineFile moves a file that is not trusted anymore into the chain's
+// directory under the given quarantine directory, and writes the reason next
+// to it. Returns the file's new path.
+func QuarantineFile(dir, chain, path string, reason error) (string, error) {
+	if chain == "" {
+		chain = "unknown"
+	}
+	to := filepath.Join(dir, chain, filepath.Base(path))
+	return to, quarantine(path, to, reason)
+}
+
+// Moves a file to the given path, and writes the reason next to it.
+func quarantine(path, to string, reason error) error {
+	err := mkdir(filepath.Dir(to))
+	if err != nil {
+		return err
+	}
+	err = os.Rename(path, to)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(to+".reason.txt", []byte(reason.Error()+"\n"),
+		0600)
+}
+
+// Checks that the file has at least minSize bytes, that it is an intact gzip
+// or zip archive or a plain file, and that the data in it starts like XML.
+// Returns an invalidFileError if a check fails, or another error if the file
+// cannot be read.
+func validateFile(path string, minSize int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < minSize {
+		return invalidf("size is %d, expected at least %d", info.Size(),
+			minSize)
+	}
+
+	magic := make([]byte, 4)
+	n, _ := io.ReadFull(f, magic)
+	magic = magic[:n]
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return validateGzip(f)
+	case bytes.HasPrefix(magic, []byte("PK\x03\x04")):
+		return validateZip(f, info.Size())
+	default:
+		return validateXML(f)
+	}
+}
+
+// Checks that the gzip stream is intact and has XML in it.
+func validateGzip(r io.Reader) error {
+	z, err := gzip.NewReader(r)
+	if err != nil {
+		return invalidf("bad gzip: %v", err)
+	}
+	defer z.Close()
+	err = validateXML(z)
+	if err != nil {
+		return err
+	}
+	// Read to the end, where the checksum is verified.
+	_, err = io.Copy(ioutil.Discard, z)
+	if err != nil {
+		return invalidf("bad gzip: %v", err)
+	}
+	return nil
+}
+
+// Checks that the zip archive is intact and that its files have XML in them.
+func validateZip(r io.ReaderAt, size int64) error {
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return invalidf("bad zip: %v", err)
+	}
+	if len(z.File) == 0 {
+		return invalidf("empty zip")
+	}
+	for _, file := range z.File {
+		fr, err := file.Open()
+		if err != nil {
+			return invalidf("bad zip entry %s: %v", file.Name, err)
+		}
+		err = validateXML(fr)
+		if err == nil {
+			// Read to the end, where the checksum is verified.
+			if _, cerr := io.Copy(ioutil.Discard, fr); cerr != nil {
+				err = invalidf("bad zip entry %s: %v", file.Name, cerr)
+			}
+		}
+		fr.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Checks that the data starts like XML and has a root element, which is not
+// of an HTML page. Reads only up to the root element.
+func validateXML(r io.Reader) error {
+	br := bufio.NewReader(r)
+	start, _ := br.Peek(512)
+	start = bytes.TrimPrefix(start, []byte("\xef\xbb\xbf"))
+	start = bytes.TrimLeft(start, " \t\r\n")
+	if len(start) == 0 {
+		return invalidf("no data")
+	}
+	if start[0] != '<' {
+		return invalidf("does not start like XML: %q", cut(start, 20))
+	}
+
+	dec := xml.NewDecoder(br)
+	dec.Strict = false
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader,
+		error) {
+		return input, nil // Only the structure is checked.
+	}
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return invalidf("no root element: %v", err)
+		}
+		if elem, ok := tok.(xml.StartElement); ok {
+			if strings.EqualFold(elem.Name.Local, "html") {
+				return invalidf("got an HTML page")
+			}
+			return nil
+		}
+	}
+}
+
+// Returns the first n bytes of b, or b if it is shorter.
+func cut(b []byte, n int) []byte {
+	if len(b) > n {
+		return b[:n]
+	}
+	return b
+}
@@ -0,0 +1,136 @@
+package scrapers
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const validXML = `<?xml version="1.0" encoding="windows-1255"?>
+<root><ChainId>7290027600007</ChainId></root>`
+
+// Returns the data gzipped.
+func gzipped(data string) string {
+	buf := &bytes.Buffer{}
+	z := gzip.NewWriter(buf)
+	z.Write([]byte(data))
+	z.Close()
+	return buf.String()
+}
+
+// Returns the data in a zip archive.
+func zipped(data string) string {
+	buf := &bytes.Buffer{}
+	z := zip.NewWriter(buf)
+	w, _ := z.Create("file.xml")
+	w.Write([]byte(data))
+	z.Close()
+	return buf.String()
+}
+
+func TestValidateFile(t *testing.T) {
+	gz := gzipped(validXML)
+	tests := []struct {
+		data string
+		ok   bool
+	}{
+		{validXML, true},
+		{"\xef\xbb\xbf\r\n" + validXML, true},
+		{gz, true},
+		{zipped(validXML), true},
+		{"", false},
+		{"  \n", false},
+		{"Error 500", false},
+		{"<!DOCTYPE html><html><body>Error</body></html>", false},
+		{"<?xml version=\"1.0\"?>", false},
+		{gz[:len(gz)-6], false},
+		{gzipped("<html>"), false},
+		{zipped("oops"), false},
+		{validXML[:30], false},
+	}
+	dir := t.TempDir()
+	for i, test := range tests {
+		path := filepath.Join(dir, "file")
+		ioutil.WriteFile(path, []byte(test.data), 0600)
+		err := validateFile(path, 10)
+		if (err == nil) != test.ok {
+			t.Errorf("#%v: validateFile(%q)=%v want ok=%v", i+1, test.data,
+				err, test.ok)
+		}
+		if err != nil && !isInvalidFile(err) {
+			t.Errorf("#%v: validateFile(%q)=%v want an invalid file error",
+				i+1, test.data, err)
+		}
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	defer func() { validation = nil }()
+	out := t.TempDir()
+	SetValidation(Validation{MinSize: 10,
+		Quarantine: filepath.Join(out, "quarantine")})
+
+	s := newFakeSite(t)
+	s.handle("/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/Price") {
+			w.Write([]byte("<html>Server error</html>"))
+		} else {
+			w.Write([]byte(validXML))
+		}
+	})
+	files := []*RemoteFile{
+		{Name: "Price7290027600007-001-202610170300.xml",
+			URL: s.home() + "Price7290027600007-001-202610170300.xml"},
+		{Name: "Stores7290027600007-202610170100.xml",
+			URL: s.home() + "Stores7290027600007-202610170100.xml"},
+	}
+
+	stats := &Stats{}
+	ctx := WithStats(WithChain(context.Background(), "chain"), stats)
+	dir := filepath.Join(out, "chain")
+	if err := downloadFiles(ctx, dir, files, nil); err == nil {
+		t.Errorf("downloadFiles(...) succeeded, want error")
+	}
+
+	bad := filepath.Join(out, "quarantine", "chain", files[0].Name)
+	if fileExists(filepath.Join(dir, files[0].Name)) || !fileExists(bad) ||
+		!fileExists(bad+".reason.txt") {
+		t.Errorf("downloadFiles(...) did not quarantine %s", files[0].Name)
+	}
+	if !fileExists(filepath.Join(dir, files[1].Name)) {
+		t.Errorf("downloadFiles(...) did not save %s", files[1].Name)
+	}
+	snap := stats.Snapshot()
+	if snap.Failed != 1 || snap.Errors["invalid"] != 1 ||
+		snap.Downloaded != 1 {
+		t.Errorf("downloadFiles(...) counted %+v, want 1 invalid and 1"+
+			" downloaded", snap)
+	}
+}
+
+func TestSaveFileValidates(t *testing.T) {
+	defer func() { validation = nil }()
+	out := t.TempDir()
+	SetValidation(Validation{Quarantine: filepath.Join(out, "quarantine")})
+
+	ctx := WithChain(context.Background(), "coop")
+	to := filepath.Join(out, "coop", "Price7290633800006-101-202610170300.gz")
+	mkdir(filepath.Dir(to))
+	err := saveFile(ctx, strings.NewReader("<html>Error</html>"), to)
+	if !isInvalidFile(err) {
+		t.Fatalf("saveFile(...) error=%v, want invalid file", err)
+	}
+	if fileExists(to) || fileExists(to+partSuffix) {
+		t.Errorf("saveFile(...) left an invalid file behind")
+	}
+	if !fileExists(filepath.Join(out, "quarantine", "coop",
+		filepath.Base(to))) {
+		t.Errorf("saveFile(...) did not quarantine the file by its name")
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+// Machine-readable summary of a scrape run.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fluhus/prices/scrape/scrapers"
+)
+
+// Exit codes of the program.
+const (
+	exitOK         = 0 // All chains finished successfully.
+	exitUsage      = 1 // Bad arguments or failed setup, nothing was scraped.
+	exitSomeFailed = 2 // Some chains failed and some succeeded.
+	exitAllFailed  = 3 // All chains failed.
+)
+
+// Values for chainSummary.Status.
+const (
+	statusOK     = "ok"
+	statusFailed = "failed"
+)
+
+// Summarizes a whole run.
+type runSummary struct {
+	Start     time.Time       `json:"start"`
+	Duration  float64         `json:"duration_sec"`
+	Succeeded int             `json:"succeeded"`
+	Failed    int             `json:"failed"`
+	Chains    []*chainSummary `json:"chains"`
+
+	// Differences from the authority's chain list, nil if not checked.
+	ChainCheck *chainsDiff `json:"chain_check,omitempty"`
+}
+
+// Summarizes the scraping of a single chain.
+type chainSummary struct {
+	Chain    string   `json:"chain"`
+	Types    []string `json:"types,omitempty"` // Set by the daemon schedule.
+	Status   string   `json:"status"`
+	Error    string   `json:"error,omitempty"`
+	Duration float64  `json:"duration_sec"`
+	scrapers.StatsSnapshot
+}
+
+// Adds a chain's summary to the run. Nil summaries are ignored.
+func (s *runSummary) add(cs *chainSummary) {
+	if cs == nil {
+		return
+	}
+	s.Chains = append(s.Chains, cs)
+	if cs.Status == statusOK {
+		s.Succeeded++
+	} else {
+		s.Failed++
+	}
+}
+
+// Sets a chain's summary in the run, replacing the chain's previous summary
+// with the same file types if any. Nil summaries are ignored.
+func (s *runSummary) set(cs *chainSummary) {
+	if cs == nil {
+		return
+	}
+	for i, old := range s.Chains {
+		if old.Chain == cs.Chain && strings.Join(old.Types, "+") ==
+			strings.Join(cs.Types, "+") {
+			s.Chains = append(s.Chains[:i], s.Chains[i+1:]...)
+			if old.Status == statusOK {
+				s.Succeeded--
+			} else {
+				s.Failed--
+			}
+			break
+		}
+	}
+	s.add(cs)
+}
+
+// Returns the exit code that reflects the run's outcome.
+func (s *runSummary) exitCode() int {
+	switch {
+	case s.Failed == 0:
+		return exitOK
+	case s.Succeeded == 0:
+		return exitAllFailed
+	default:
+		return exitSomeFailed
+	}
+}
+
+// Writes the summary as JSON to the given file, or to stdout if the file is
+// "-".
+func (s *runSummary) write(file string) error {
+	j, err := json.MarshalIndent(s, "", "\t")
+	if err != nil {
+		return err
+	}
+	j = append(j, '\n')
+	if file == "-" {
+		_, err = os.Stdout.Write(j)
+		return err
+	}
+	return ioutil.WriteFile(file, j, 0600)
+}
+
+// Returns the name that should be given to the summary file.
+func summaryFileName() string {
+	t := time.Now()
+	return fmt.Sprintf("Summary-%d%02d%02d%02d%02d.json",
+		t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute())
+}